@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/saracen/go7z"
+	"github.com/saracen/go7z/headers"
+)
+
+var (
+	outputDir string
+	overwrite = overwriteFlag(go7z.OverwriteError)
+)
+
+func extractFlags(fs *flag.FlagSet) {
+	fs.StringVar(&outputDir, "o", ".", "output directory")
+	fs.Var(&overwrite, "overwrite", "existing file policy: error, skip, replace or rename")
+}
+
+var overwritePolicies = []string{"error", "skip", "replace", "rename"}
+
+// overwriteFlag is a flag.Value for selecting the overwrite policy by name.
+type overwriteFlag go7z.OverwritePolicy
+
+func (f *overwriteFlag) String() string {
+	return overwritePolicies[*f]
+}
+
+func (f *overwriteFlag) Set(value string) error {
+	for i, policy := range overwritePolicies {
+		if policy == value {
+			*f = overwriteFlag(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown policy %q", value)
+}
+
+// list prints the archive's files, like 7z l.
+func list(ctx context.Context, sz *go7z.ReadCloser) error {
+	// the method is the only column of variable width
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%-19s %5s %12s %12s  %s\t%s\n", "Date      Time", "Attr", "Size", "Compressed", "Method", "Name")
+
+	folders := sz.Folders()
+	listed := make([]bool, len(folders))
+
+	var size, packedSize uint64
+	var files, dirs int
+	for _, f := range sz.File {
+		var packed, method string
+		if i := f.FolderIndex(); i >= 0 {
+			method = folders[i].Method()
+
+			// like 7z, a folder's packed size is shown against its first file
+			if !listed[i] {
+				listed[i] = true
+				packed = fmt.Sprint(folders[i].PackedSize())
+				packedSize += folders[i].PackedSize()
+			}
+		}
+
+		if f.IsDir() {
+			dirs++
+		} else {
+			files++
+		}
+		size += f.Size()
+
+		fmt.Fprintf(w, "%19s %5s %12d %12s  %s\t%s\n", date(f.ModifiedAt), attributes(f), f.Size(), packed, method, f.Name)
+	}
+
+	fmt.Fprintf(w, "%19s %5s %12d %12d  \t%d files, %d folders\n", "", "", size, packedSize, files, dirs)
+	return w.Flush()
+}
+
+func date(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// attributes returns the file's attributes in the style of 7z, such as ....A
+// for an archived file.
+func attributes(f *go7z.File) string {
+	attr := []byte(".....")
+	if f.IsDir() {
+		attr[0] = 'D'
+	}
+	if f.IsReadonly() {
+		attr[1] = 'R'
+	}
+	if f.IsHidden() {
+		attr[2] = 'H'
+	}
+	if f.IsSystem() {
+		attr[3] = 'S'
+	}
+	if f.Attrib&headers.FileAttributeArchive != 0 {
+		attr[4] = 'A'
+	}
+	return string(attr)
+}
+
+// extract returns a command extracting the archive to the output directory,
+// with or without the files' paths.
+func extract(flatten bool) func(context.Context, *go7z.ReadCloser) error {
+	return func(ctx context.Context, sz *go7z.ReadCloser) error {
+		var opts go7z.ExtractOptions
+		opts.SetOverwritePolicy(go7z.OverwritePolicy(overwrite))
+		opts.SetFlatten(flatten)
+
+		return sz.ExtractToContext(ctx, outputDir, opts)
+	}
+}
+
+// test checks the archive's integrity, like 7z t.
+func test(ctx context.Context, sz *go7z.ReadCloser) error {
+	report, err := sz.Test(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	if report.Header != go7z.TestOK {
+		fmt.Printf("header: %v: %v\n", report.Header, report.HeaderErr)
+		failed++
+	}
+	for _, f := range report.Files {
+		if f.Status != go7z.TestOK {
+			fmt.Printf("%s: %v: %v\n", f.File.Name, f.Status, f.Err)
+			failed++
+		}
+	}
+	for _, f := range report.Folders {
+		if f.Status != go7z.TestOK {
+			fmt.Printf("folder %d: %v: %v\n", f.Folder, f.Status, f.Err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d errors", failed)
+	}
+	fmt.Printf("Everything is Ok: %d files\n", len(report.Files))
+	return nil
+}
+
+// info prints the structure of the archive's folders.
+func info(ctx context.Context, sz *go7z.ReadCloser) error {
+	folders := sz.Folders()
+
+	solid := 0
+	for _, folder := range folders {
+		if len(folder.Files) > 1 {
+			solid++
+		}
+	}
+
+	fmt.Printf("Files: %d\n", len(sz.File))
+	fmt.Printf("Folders: %d\n", len(folders))
+	fmt.Printf("Solid blocks: %d\n", solid)
+	if comment := sz.Comment(); comment != "" {
+		fmt.Printf("Comment: %s\n", comment)
+	}
+
+	for i, folder := range folders {
+		fmt.Printf("\nFolder %d: %s\n", i, folder.Method())
+		fmt.Printf("  Files: %d\n", len(folder.Files))
+		fmt.Printf("  Size: %d\n", folder.UnpackSize())
+		fmt.Printf("  Packed size: %d\n", folder.PackedSize())
+		if folder.UnpackCRC != 0 {
+			fmt.Printf("  CRC: %08X\n", folder.UnpackCRC)
+		}
+
+		for j, coder := range folder.CoderInfo {
+			fmt.Printf("  Coder %d: %s (%X), in %d, out %d, unpacked size %d", j, headers.MethodName(coder.CodecID), coder.CodecID, coder.NumInStreams, coder.NumOutStreams, folder.UnpackSizes[j])
+			if len(coder.Properties) > 0 {
+				fmt.Printf(", properties %s", hex.EncodeToString(coder.Properties))
+			}
+			fmt.Println()
+		}
+		for _, bindPair := range folder.BindPairsInfo {
+			fmt.Printf("  Bind pair: in %d <- out %d\n", bindPair.InIndex, bindPair.OutIndex)
+		}
+		for j, index := range folder.PackedIndices {
+			fmt.Printf("  Packed stream: in %d, size %d\n", index, folder.PackSizes[j])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+// Command go7z lists, extracts, tests and inspects 7z archives.
+//
+// Usage:
+//
+//	go7z <command> [flags] <archive>
+//
+// The commands are:
+//
+//	l     list the archive's contents
+//	x     extract files with their full paths
+//	e     extract files without their paths
+//	t     test the archive's integrity
+//	info  show the archive's folders, coders, bind pairs and solid blocks
+//
+// If the archive is encrypted and no password is given with -p, the password
+// is prompted for.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/saracen/go7z"
+	"golang.org/x/term"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, sz *go7z.ReadCloser) error
+	flags func(fs *flag.FlagSet)
+}
+
+var commands = []*command{
+	{name: "l", usage: "list the archive's contents", run: list},
+	{name: "x", usage: "extract files with their full paths", run: extract(false), flags: extractFlags},
+	{name: "e", usage: "extract files without their paths", run: extract(true), flags: extractFlags},
+	{name: "t", usage: "test the archive's integrity", run: test},
+	{name: "info", usage: "show the archive's folders, coders, bind pairs and solid blocks", run: info},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: go7z <command> [flags] <archive>\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-5s %s\n", cmd.name, cmd.usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd := lookup(os.Args[1])
+	if cmd == nil {
+		usage()
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	password := fs.String("p", "", "archive password")
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: go7z %s [flags] <archive>\n\n", cmd.name)
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[2:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, cmd, fs.Arg(0), *password); err != nil {
+		fmt.Fprintf(os.Stderr, "go7z: %v\n", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+// lookup returns the command with the given name, or nil if there is none.
+func lookup(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func run(ctx context.Context, cmd *command, name, password string) error {
+	var opts go7z.ReaderOptions
+	opts.SetPassword(password)
+	opts.SetPasswordCallback(prompt)
+
+	sz, err := go7z.OpenReaderContext(ctx, name, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	defer sz.Close()
+
+	return cmd.run(ctx, sz)
+}
+
+// prompt asks for the archive's password. If stdin is a terminal, the
+// password isn't echoed. Otherwise, such as when it's piped, a line is read.
+func prompt() string {
+	fmt.Fprint(os.Stderr, "Enter password: ")
+
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return ""
+		}
+		return string(password)
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return ""
+	}
+	return strings.TrimRight(password, "\r\n")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/saracen/go7z"
+	"github.com/saracen/go7z/headers"
+)
+
+// writeArchive writes an archive holding a directory and a file to dir.
+func writeArchive(t *testing.T, dir string) string {
+	name := filepath.Join(dir, "test.7z")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	sz, err := go7z.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sz.Create(&headers.FileInfo{Name: "dir", IsEmptyStream: true}); err != nil {
+		t.Fatal(err)
+	}
+	w, err := sz.Create(&headers.FileInfo{Name: "dir/hello.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("hello world\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err = sz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return name
+}
+
+// capture runs the command on the archive, returning what it writes to
+// standard output.
+func capture(t *testing.T, ctx context.Context, name, archive string) (string, error) {
+	f, err := ioutil.TempFile("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	stdout := os.Stdout
+	os.Stdout = f
+	err = run(ctx, lookup(name), archive, "")
+	os.Stdout = stdout
+
+	out, rerr := ioutil.ReadFile(f.Name())
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	return string(out), err
+}
+
+func TestList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out, err := capture(t, context.Background(), "l", writeArchive(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"dir/hello.txt", "LZMA2", "1 files, 1 folders"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected listing to contain %q, got:\n%s", s, out)
+		}
+	}
+}
+
+func TestTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out, err := capture(t, context.Background(), "t", writeArchive(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Everything is Ok: 2 files\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := writeArchive(t, dir)
+	outputDir = filepath.Join(dir, "out")
+	defer func() { outputDir = "" }()
+
+	if _, err = capture(t, context.Background(), "x", archive); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "dir", "hello.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "hello world\n" {
+		t.Errorf("unexpected contents %q", contents)
+	}
+}
+
+func TestExtractCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sz, err := go7z.OpenReader(writeArchive(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sz.Close()
+
+	outputDir = filepath.Join(dir, "out")
+	defer func() { outputDir = "" }()
+
+	// the command's context stops extraction, not just the reader's
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = lookup("x").run(ctx, sz); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(outputDir, "dir", "hello.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be extracted, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package go7z
+
+import (
+	"fmt"
+
+	"github.com/saracen/go7z/headers"
+	"github.com/saracen/solidblock"
+)
+
+// UnsupportedCodecError is returned when a folder uses a codec that has no
+// registered decompressor.
+type UnsupportedCodecError struct {
+	CodecID uint32
+}
+
+func (e *UnsupportedCodecError) Error() string {
+	return fmt.Sprintf("%v: codec %#x (%s)", ErrDecompressorNotFound, e.CodecID, headers.MethodName(e.CodecID))
+}
+
+// Unwrap returns ErrDecompressorNotFound.
+func (e *UnsupportedCodecError) Unwrap() error {
+	return ErrDecompressorNotFound
+}
+
+// ChecksumError is returned when a file's contents don't match its CRC. File
+// is nil for streams that aren't files, such as an encoded header.
+type ChecksumError struct {
+	File     *File
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *ChecksumError) Error() string {
+	msg := fmt.Sprintf("%v: expected %08x, got %08x", headers.ErrChecksumMismatch, e.Expected, e.Actual)
+	if e.File != nil {
+		return e.File.Name + ": " + msg
+	}
+	return msg
+}
+
+// Unwrap returns headers.ErrChecksumMismatch.
+func (e *ChecksumError) Unwrap() error {
+	return headers.ErrChecksumMismatch
+}
+
+// Is reports whether target is solidblock.ErrChecksumMismatch, which was
+// previously returned for files not matching their CRC.
+func (e *ChecksumError) Is(target error) bool {
+	return target == solidblock.ErrChecksumMismatch
+}
+
+// PackChecksumError is returned when a packed stream doesn't match the CRC
+// recorded for it. Index is the pack stream's index in the archive.
+type PackChecksumError struct {
+	Index int
+}
+
+func (e *PackChecksumError) Error() string {
+	return fmt.Sprintf("pack stream %d: %v", e.Index, headers.ErrChecksumMismatch)
+}
+
+// Unwrap returns headers.ErrChecksumMismatch.
+func (e *PackChecksumError) Unwrap() error {
+	return headers.ErrChecksumMismatch
+}
+
+// HeaderError is returned when the archive header can't be read. Offset is the
+// offset within the header, after any decoding, that the error occurred at,
+// or -1 if unknown. PropertyID is the unexpected property id read, if that
+// was the cause.
+type HeaderError struct {
+	Offset     int64
+	PropertyID byte
+	Err        error
+}
+
+func (e *HeaderError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("header: %v", e.Err)
+	}
+	return fmt.Sprintf("header offset %d: %v", e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *HeaderError) Unwrap() error {
+	return e.Err
+}
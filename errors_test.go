@@ -0,0 +1,104 @@
+package go7z
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/saracen/go7z/headers"
+	"github.com/saracen/solidblock"
+)
+
+func TestUnsupportedCodecError(t *testing.T) {
+	sz := openTestArchive(t, testEntries, nil)
+	sz.folders[0].folder.CoderInfo[0].CodecID = 0xdead
+
+	_, err := sz.File[1].Open()
+
+	var codecErr *UnsupportedCodecError
+	if !errors.As(err, &codecErr) || codecErr.CodecID != 0xdead {
+		t.Fatalf("expected unsupported codec 0xdead, got %v", err)
+	}
+	if !errors.Is(err, ErrDecompressorNotFound) {
+		t.Fatalf("expected error to be ErrDecompressorNotFound")
+	}
+
+	// codecs without a method name are named by their id
+	if !strings.Contains(err.Error(), "DEAD") {
+		t.Errorf("expected %q to name the codec", err)
+	}
+}
+
+func TestChecksumError(t *testing.T) {
+	sz := openTestArchive(t, testEntries, nil)
+	expected := sz.folders[0].crcs[1] ^ 1
+	sz.folders[0].crcs[1] = expected
+
+	rc, err := sz.File[3].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	_, err = io.Copy(ioutil.Discard, rc)
+
+	var crcErr *ChecksumError
+	if !errors.As(err, &crcErr) {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	if crcErr.File != sz.File[3] || crcErr.Expected != expected || crcErr.Actual != expected^1 {
+		t.Fatalf("unexpected checksum error %+v", crcErr)
+	}
+	if !errors.Is(err, headers.ErrChecksumMismatch) || !errors.Is(err, solidblock.ErrChecksumMismatch) {
+		t.Fatalf("expected error to be a checksum mismatch")
+	}
+}
+
+func TestChecksumErrorSkipped(t *testing.T) {
+	sz := openTestArchive(t, testEntries, nil)
+	expected := sz.folders[0].crcs[0] ^ 1
+	sz.folders[0].crcs[0] = expected
+
+	// skipping over the file without reading it still checks its crc
+	var err error
+	for err == nil {
+		_, err = sz.Next()
+	}
+
+	var crcErr *ChecksumError
+	if !errors.As(err, &crcErr) {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	if crcErr.File != sz.folders[0].files[0] || crcErr.Expected != expected || crcErr.Actual != expected^1 {
+		t.Fatalf("unexpected checksum error %+v", crcErr)
+	}
+}
+
+func TestHeaderError(t *testing.T) {
+	f := writeTestArchive(t, testEntries, nil)
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the header's first property id
+	offset := headers.SignatureHeaderSize + binary.LittleEndian.Uint64(data[12:])
+	data[offset+1] = 0x30
+
+	_, err = NewReader(bytes.NewReader(data), int64(len(data)))
+
+	var headerErr *HeaderError
+	if !errors.As(err, &headerErr) {
+		t.Fatalf("expected header error, got %v", err)
+	}
+	if headerErr.Offset != 2 || headerErr.PropertyID != 0x30 {
+		t.Fatalf("unexpected header error %+v", headerErr)
+	}
+	if !errors.Is(err, headers.ErrUnexpectedPropertyID) {
+		t.Fatalf("expected error to be headers.ErrUnexpectedPropertyID")
+	}
+}
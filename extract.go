@@ -0,0 +1,403 @@
+package go7z
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ExtractHandler is called by ExtractAll for each file in the archive. r
+// provides the file's contents and is only valid until the handler returns.
+// Any contents not read by the handler are still decompressed and checked
+// against the file's CRC.
+type ExtractHandler func(f *File, r io.Reader) error
+
+// ExtractAll decompresses every file in the archive, calling handler for each
+// one. Independent folders are decompressed concurrently by up to concurrency
+// goroutines, so handler may be called concurrently. Files within a folder are
+// always handled in archive order. A concurrency of zero or less uses
+// GOMAXPROCS.
+//
+// The first error returned by handler, or encountered whilst decompressing,
+// stops the extraction and is returned.
+func (sz *Reader) ExtractAll(ctx context.Context, handler ExtractHandler, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// files without contents don't need decompressing
+	files := make([][]*File, len(sz.folders))
+	for _, f := range sz.File {
+		if f.IsEmptyStream {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := handler(f, bytes.NewReader(nil)); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.folder < 0 {
+			return ErrNotSupported
+		}
+		files[f.folder] = append(files[f.folder], f)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	folders := make(chan int)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for folder := range folders {
+				if err := sz.extractFolder(ctx, folder, files[folder], handler); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+loop:
+	for folder := range files {
+		if len(files[folder]) == 0 {
+			continue
+		}
+		select {
+		case folders <- folder:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(folders)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func (sz *Reader) extractFolder(ctx context.Context, folder int, files []*File, handler ExtractHandler) error {
+	fr, err := sz.folders[folder].reopen()
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fr.Next(); err != nil {
+			return err
+		}
+
+		r := &contextReader{ctx: ctx, r: fr}
+		if err := handler(f, r); err != nil {
+			return err
+		}
+
+		// drain any remaining contents so that the crc is checked
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			return err
+		}
+	}
+
+	// finish the folder, so that its last stream is checked
+	if err := fr.Next(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// ErrInsecurePath is returned by ExtractTo when a file's name is absolute or
+// would be extracted outside of the destination directory.
+var ErrInsecurePath = errors.New("insecure file path")
+
+// OverwritePolicy controls what ExtractTo does when a file being extracted
+// already exists.
+type OverwritePolicy int
+
+const (
+	// OverwriteError stops the extraction with an error satisfying
+	// errors.Is(err, fs.ErrExist).
+	OverwriteError OverwritePolicy = iota
+
+	// OverwriteSkip leaves the existing file untouched.
+	OverwriteSkip
+
+	// OverwriteReplace replaces the existing file.
+	OverwriteReplace
+
+	// OverwriteRename extracts the file under a new name, such as name_1.txt.
+	OverwriteRename
+)
+
+// ExtractOptions are optional options to configure ExtractTo.
+type ExtractOptions struct {
+	overwrite OverwritePolicy
+	flatten   bool
+}
+
+// SetOverwritePolicy sets what happens when a file being extracted already
+// exists. The default is OverwriteError.
+func (o *ExtractOptions) SetOverwritePolicy(policy OverwritePolicy) {
+	o.overwrite = policy
+}
+
+// SetFlatten sets whether files are extracted without their paths, directly
+// into the destination directory, like 7z e. Directories aren't created.
+func (o *ExtractOptions) SetFlatten(flatten bool) {
+	o.flatten = flatten
+}
+
+// ExtractTo extracts the archive to the directory dir, creating it if needed.
+// Names that are absolute or contain .. elements escaping dir are rejected
+// with ErrInsecurePath, as are files that would be written through a symbolic
+// link. Directories and symbolic links are created, permissions and
+// modification and access times are restored, and anti-files remove their
+// existing counterparts.
+//
+// Extraction stops with an error once the reader's context is done.
+func (sz *Reader) ExtractTo(dir string, opts ExtractOptions) error {
+	return sz.ExtractToContext(sz.Options.Context(), dir, opts)
+}
+
+// ExtractToContext extracts the archive to the directory dir, like ExtractTo,
+// stopping with ctx.Err() once ctx is done.
+func (sz *Reader) ExtractToContext(ctx context.Context, dir string, opts ExtractOptions) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	// check every name before anything is written
+	names := make(map[*File]string, len(sz.File))
+	for _, f := range sz.File {
+		name, err := sanitizeName(f.Name)
+		if err != nil {
+			return err
+		}
+		if opts.flatten && (f.IsDir() || name == "") {
+			continue
+		}
+		if opts.flatten {
+			name = path.Base(name)
+		}
+		names[f] = name
+	}
+
+	var dirs []*File
+	err := sz.ExtractAll(ctx, func(f *File, r io.Reader) error {
+		name := names[f]
+		if name == "" {
+			return nil
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		parent := path.Dir(name)
+		if f.IsDir() {
+			parent = name
+		}
+		if err := checkSymlinks(dir, parent); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		switch {
+		case f.IsAntiFile:
+			err := os.Remove(target)
+			if f.IsDir() || os.IsNotExist(err) {
+				// directories are only removed once empty
+				return nil
+			}
+			return err
+
+		case f.IsDir():
+			dirs = append(dirs, f)
+			return os.MkdirAll(target, 0777)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return err
+		}
+
+		if f.IsSymlink() {
+			// a symbolic link's contents are its target, which is never
+			// longer than a path
+			link, err := ioutil.ReadAll(io.LimitReader(r, 4096))
+			if err != nil {
+				return err
+			}
+
+			_, err = create(target, opts.overwrite, func(name string) error {
+				return os.Symlink(string(link), name)
+			})
+			return err
+		}
+
+		var w *os.File
+		target, err := create(target, opts.overwrite, func(name string) (err error) {
+			w, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+			return err
+		})
+		if err != nil || target == "" {
+			return err
+		}
+
+		if _, err = io.Copy(w, r); err != nil {
+			w.Close()
+			return err
+		}
+		if err = w.Close(); err != nil {
+			return err
+		}
+
+		if err = os.Chmod(target, f.Mode().Perm()); err != nil {
+			return err
+		}
+		return setTimes(target, f)
+	}, 1)
+	if err != nil {
+		return err
+	}
+
+	// directories are restored last, as extracting into a directory modifies
+	// its times and could be prevented by its permissions
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := checkSymlinks(dir, names[dirs[i]]); err != nil {
+			return fmt.Errorf("%s: %w", dirs[i].Name, err)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(names[dirs[i]]))
+		if err := os.Chmod(target, dirs[i].Mode().Perm()); err != nil {
+			return err
+		}
+		if err := setTimes(target, dirs[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sanitizeName returns the file's name as a clean, slash separated, relative
+// path, or an empty string if it refers to the destination directory itself.
+func sanitizeName(name string) (string, error) {
+	clean := path.Clean(strings.Replace(name, `\`, "/", -1))
+
+	switch {
+	case strings.HasPrefix(clean, "/"),
+		runtime.GOOS == "windows" && hasDriveLetter(clean),
+		clean == "..",
+		strings.HasPrefix(clean, "../"),
+		strings.IndexByte(clean, 0) >= 0:
+		return "", fmt.Errorf("%s: %w", name, ErrInsecurePath)
+
+	case clean == ".":
+		return "", nil
+	}
+
+	return clean, nil
+}
+
+// hasDriveLetter returns whether name starts with a Windows drive letter, such
+// as "C:". Other names containing a colon are relative names.
+func hasDriveLetter(name string) bool {
+	if len(name) < 2 || name[1] != ':' {
+		return false
+	}
+	c := name[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+// checkSymlinks returns ErrInsecurePath if any element of the slash separated
+// path name within dir is an existing symbolic link, as following it could
+// escape dir.
+func checkSymlinks(dir, name string) error {
+	if name == "." {
+		return nil
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		dir = filepath.Join(dir, elem)
+
+		fi, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return ErrInsecurePath
+		}
+	}
+
+	return nil
+}
+
+// create calls fn to create the named file, following the overwrite policy if
+// it already exists. The name of the file created is returned, or an empty
+// string if it was skipped.
+func create(name string, policy OverwritePolicy, fn func(name string) error) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	for i := 1; ; i++ {
+		err := fn(name)
+		if !os.IsExist(err) {
+			return name, err
+		}
+
+		switch policy {
+		case OverwriteSkip:
+			return "", nil
+
+		case OverwriteReplace:
+			if err := os.Remove(name); err != nil {
+				return "", err
+			}
+			// only replace once, in case of a race with another writer
+			policy = OverwriteError
+
+		case OverwriteRename:
+			name = fmt.Sprintf("%s_%d%s", base, i, ext)
+
+		default:
+			return "", err
+		}
+	}
+}
+
+func setTimes(name string, f *File) error {
+	if f.ModifiedAt.IsZero() {
+		return nil
+	}
+
+	atime := f.AccessedAt
+	if atime.IsZero() {
+		atime = f.ModifiedAt
+	}
+	return os.Chtimes(name, atime, f.ModifiedAt)
+}
@@ -0,0 +1,417 @@
+package go7z
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/saracen/go7z/headers"
+)
+
+func TestExtractAll(t *testing.T) {
+	for _, solid := range []bool{true, false} {
+		sz := openTestArchive(t, testEntries, func(o *WriterOptions) { o.SetSolid(solid) })
+
+		var mu sync.Mutex
+		extracted := make(map[string][]byte)
+		err := sz.ExtractAll(context.Background(), func(f *File, r io.Reader) error {
+			contents, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			extracted[f.Name] = contents
+			return nil
+		}, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(extracted) != len(testEntries) {
+			t.Fatalf("expected %d files, got %d", len(testEntries), len(extracted))
+		}
+		for _, entry := range testEntries {
+			if !bytes.Equal(extracted[entry.Name], entry.Contents) {
+				t.Fatalf("%v: contents mismatch", entry.Name)
+			}
+		}
+	}
+}
+
+func TestExtractAllPasswordCallback(t *testing.T) {
+	f := writeTestArchive(t, testEntries, func(o *WriterOptions) {
+		o.SetSolid(false)
+		o.SetPassword("password")
+		o.SetNumCyclesPower(10)
+	})
+
+	size := testArchiveSize(t, f)
+
+	// each folder is encrypted, so every goroutine needs the password
+	var prompts int32
+	var opts ReaderOptions
+	opts.SetPasswordCallback(func() string {
+		atomic.AddInt32(&prompts, 1)
+		return "password"
+	})
+
+	sz, err := NewReaderWithOptions(f, size, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sz.folders) < 2 {
+		t.Fatalf("expected multiple folders, got %d", len(sz.folders))
+	}
+
+	// every folder is started before any is read, so that their decoders,
+	// and calls for the password, are all set up concurrently
+	var started sync.WaitGroup
+	started.Add(len(sz.folders))
+
+	var mu sync.Mutex
+	extracted := make(map[string][]byte)
+	err = sz.ExtractAll(context.Background(), func(f *File, r io.Reader) error {
+		if f.IsEmptyStream {
+			return nil
+		}
+		started.Done()
+		started.Wait()
+
+		contents, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		extracted[f.Name] = contents
+		return nil
+	}, len(sz.folders))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range testEntries {
+		if !bytes.Equal(extracted[entry.Name], entry.Contents) {
+			t.Fatalf("%v: contents mismatch", entry.Name)
+		}
+	}
+	if prompts != 1 {
+		t.Fatalf("expected password callback to be called once, got %d", prompts)
+	}
+}
+
+func TestExtractAllHandlerError(t *testing.T) {
+	sz := openTestArchive(t, testEntries, func(o *WriterOptions) { o.SetSolid(false) })
+
+	errHandler := errors.New("handler error")
+	err := sz.ExtractAll(context.Background(), func(f *File, r io.Reader) error {
+		if f.Name == "random.bin" {
+			return errHandler
+		}
+		return nil
+	}, 2)
+	if err != errHandler {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+}
+
+func TestExtractTo(t *testing.T) {
+	f := writeTestArchive(t, testEntries, nil)
+	size := testArchiveSize(t, f)
+
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	extract := func(policy OverwritePolicy) error {
+		sz, err := NewReader(f, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var opts ExtractOptions
+		opts.SetOverwritePolicy(policy)
+		return sz.ExtractTo(dir, opts)
+	}
+
+	if err = extract(OverwriteError); err != nil {
+		t.Fatal(err)
+	}
+
+	modified := time.Date(2019, 6, 23, 16, 57, 46, 0, time.UTC)
+	for _, entry := range testEntries {
+		name := filepath.Join(dir, filepath.FromSlash(entry.Name))
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.IsDir() != entry.Dir {
+			t.Fatalf("%v: expected directory %v", entry.Name, entry.Dir)
+		}
+		if !fi.ModTime().Equal(modified) {
+			t.Errorf("%v: expected modification time %v, got %v", entry.Name, modified, fi.ModTime())
+		}
+		if entry.Dir {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, entry.Contents) {
+			t.Fatalf("%v: contents mismatch", entry.Name)
+		}
+	}
+
+	hello := filepath.Join(dir, "dir", "hello.txt")
+	if err = ioutil.WriteFile(hello, []byte("changed"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = extract(OverwriteError); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected fs.ErrExist, got %v", err)
+	}
+
+	if err = extract(OverwriteSkip); err != nil {
+		t.Fatal(err)
+	}
+	if contents, _ := ioutil.ReadFile(hello); string(contents) != "changed" {
+		t.Fatalf("expected skipped file to be unchanged, got %q", contents)
+	}
+
+	if err = extract(OverwriteRename); err != nil {
+		t.Fatal(err)
+	}
+	if contents, _ := ioutil.ReadFile(filepath.Join(dir, "dir", "hello_1.txt")); string(contents) != "hello world\n" {
+		t.Fatalf("expected renamed file, got %q", contents)
+	}
+
+	if err = extract(OverwriteReplace); err != nil {
+		t.Fatal(err)
+	}
+	if contents, _ := ioutil.ReadFile(hello); string(contents) != "hello world\n" {
+		t.Fatalf("expected replaced file, got %q", contents)
+	}
+}
+
+func TestExtractToFlatten(t *testing.T) {
+	sz := openTestArchive(t, testEntries, nil)
+
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var opts ExtractOptions
+	opts.SetFlatten(true)
+	if err = sz.ExtractTo(dir, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{"empty.txt", "hello.txt", "random.bin", "unicode-éè.txt"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestExtractToAntiFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	removed := filepath.Join(dir, "removed.txt")
+	if err = ioutil.WriteFile(removed, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w, err := NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Create(&headers.FileInfo{Name: "removed.txt", IsEmptyStream: true, IsEmptyFile: true, IsAntiFile: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	size := testArchiveSize(t, f)
+
+	sz, err := NewReader(f, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sz.ExtractTo(dir, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(removed); !os.IsNotExist(err) {
+		t.Fatalf("expected anti-file to remove file, got %v", err)
+	}
+}
+
+func TestExtractToInsecurePath(t *testing.T) {
+	names := []string{"../evil.txt", "dir/../../evil.txt", "/evil.txt", `..\evil.txt`}
+	if runtime.GOOS == "windows" {
+		names = append(names, "C:/evil.txt", "c:evil.txt")
+	}
+
+	for _, name := range names {
+		sz := openTestArchive(t, []testEntry{
+			{Name: "good.txt", Contents: []byte("good")},
+			{Name: name, Contents: []byte("evil")},
+		}, nil)
+
+		dir, err := ioutil.TempDir("", "go7z")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err = sz.ExtractTo(dir, ExtractOptions{}); !errors.Is(err, ErrInsecurePath) {
+			t.Fatalf("%v: expected ErrInsecurePath, got %v", name, err)
+		}
+
+		// nothing is extracted when any name is insecure
+		if _, err = os.Stat(filepath.Join(dir, "good.txt")); !os.IsNotExist(err) {
+			t.Fatalf("%v: expected no files to be extracted", name)
+		}
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := map[string]string{
+		".":               "",
+		"./dir/file.txt":  "dir/file.txt",
+		`dir\file.txt`:    "dir/file.txt",
+		"dir/../file.txt": "file.txt",
+		"1:2.txt":         "1:2.txt",
+		"dir/a:b.txt":     "dir/a:b.txt",
+	}
+
+	// drive letters only have meaning on windows
+	if runtime.GOOS != "windows" {
+		tests["a:b.txt"] = "a:b.txt"
+		tests["C:/file.txt"] = "C:/file.txt"
+	}
+
+	for name, expected := range tests {
+		clean, err := sanitizeName(name)
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+		}
+		if clean != expected {
+			t.Errorf("%v: expected %q, got %q", name, expected, clean)
+		}
+	}
+}
+
+func TestExtractToUnixMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix modes and symbolic links are not supported on windows")
+	}
+
+	unix := func(mode uint32) uint32 {
+		return mode<<16 | headers.FileAttributeUnixExtension
+	}
+
+	sz := openTestArchive(t, []testEntry{
+		{Name: "dir", Dir: true, Attrib: unix(0040700)},
+		{Name: "dir/private.txt", Contents: []byte("private"), Attrib: unix(0100600)},
+		{Name: "dir/link", Contents: []byte("private.txt"), Attrib: unix(0120777)},
+	}, nil)
+
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = sz.ExtractTo(dir, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, mode := range map[string]os.FileMode{"dir": os.ModeDir | 0700, "dir/private.txt": 0600} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != mode {
+			t.Errorf("%v: expected mode %v, got %v", name, mode, fi.Mode())
+		}
+	}
+
+	target, err := os.Readlink(filepath.Join(dir, "dir", "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "private.txt" {
+		t.Fatalf("expected link to private.txt, got %v", target)
+	}
+}
+
+func TestExtractToSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links are not supported on windows")
+	}
+
+	outside, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	sz := openTestArchive(t, []testEntry{
+		{Name: "link", Contents: []byte(outside), Attrib: 0120777<<16 | headers.FileAttributeUnixExtension},
+		{Name: "link/evil.txt", Contents: []byte("evil")},
+	}, nil)
+
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = sz.ExtractTo(dir, ExtractOptions{}); !errors.Is(err, ErrInsecurePath) {
+		t.Fatalf("expected ErrInsecurePath, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(outside, "evil.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected no file to be written outside of the directory")
+	}
+}
@@ -2,13 +2,16 @@ package filters
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
-	"hash"
+	"errors"
 	"io"
 	"strings"
+	"sync"
 	"unicode/utf16"
 )
 
@@ -16,9 +19,26 @@ var km keyManager
 
 func init() {
 	km.cache = make(map[string][]byte)
-	km.hasher = sha256.New()
 }
 
+const (
+	// AESDefaultPower is the default number of key derivation cycles, as a
+	// power of two, used when encrypting.
+	AESDefaultPower = 19
+
+	// AESMaxPower is the largest number of key derivation cycles, as a power
+	// of two, that is accepted. Like 7-Zip, larger powers are rejected, other
+	// than 0x3f, which derives a key without any cycles.
+	AESMaxPower = 24
+
+	// aesKeyCacheSize is the number of derived keys kept for decryption.
+	aesKeyCacheSize = 32
+)
+
+// ErrAESInvalidPower is returned when the number of key derivation cycles is
+// out of range.
+var ErrAESInvalidPower = errors.New("invalid aes key derivation cycles power")
+
 // AESDecrypter is an AES-256 decryptor.
 type AESDecrypter struct {
 	r    io.Reader
@@ -27,20 +47,51 @@ type AESDecrypter struct {
 	buf  [aes.BlockSize]byte
 }
 
+// keyManager caches the most recently derived decryption keys, so that
+// folders sharing a password and salt only derive their key once.
 type keyManager struct {
-	hasher hash.Hash
-	cache  map[string][]byte
+	mu    sync.Mutex
+	cache map[string][]byte
+	order []string
 }
 
-func (km *keyManager) Key(power int, salt []byte, password string) []byte {
+// Key returns the key derived from the password and salt. Deriving a key can
+// be costly, so it is abandoned with ctx.Err() if ctx is done.
+func (km *keyManager) Key(ctx context.Context, power int, salt []byte, password string) ([]byte, error) {
 	var cacheKey strings.Builder
 	cacheKey.WriteString(password)
 	cacheKey.Write(salt)
 	cacheKey.WriteByte(byte(power))
 
+	km.mu.Lock()
 	key, ok := km.cache[cacheKey.String()]
+	km.mu.Unlock()
 	if ok {
-		return key
+		return key, nil
+	}
+
+	key, err := km.derive(ctx, power, salt, password)
+	if err != nil {
+		return nil, err
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	if _, ok := km.cache[cacheKey.String()]; !ok {
+		if len(km.order) == aesKeyCacheSize {
+			delete(km.cache, km.order[0])
+			km.order = km.order[1:]
+		}
+		km.order = append(km.order, cacheKey.String())
+	}
+	km.cache[cacheKey.String()] = key
+
+	return key, nil
+}
+
+func (km *keyManager) derive(ctx context.Context, power int, salt []byte, password string) ([]byte, error) {
+	if power != 0x3f && (power < 0 || power > AESMaxPower) {
+		return nil, ErrAESInvalidPower
 	}
 
 	b := bytes.NewBuffer(nil)
@@ -49,13 +100,9 @@ func (km *keyManager) Key(power int, salt []byte, password string) []byte {
 	}
 
 	if power == 0x3f {
-		key = km.stretch(salt, b.Bytes())
-	} else {
-		key = km.sha256Stretch(power, salt, b.Bytes())
+		return km.stretch(salt, b.Bytes()), nil
 	}
-
-	km.cache[cacheKey.String()] = key
-	return key
+	return km.sha256Stretch(ctx, power, salt, b.Bytes())
 }
 
 func (km *keyManager) stretch(salt, password []byte) []byte {
@@ -75,12 +122,20 @@ func (km *keyManager) stretch(salt, password []byte) []byte {
 	return key[:]
 }
 
-func (km *keyManager) sha256Stretch(power int, salt, password []byte) []byte {
+func (km *keyManager) sha256Stretch(ctx context.Context, power int, salt, password []byte) ([]byte, error) {
+	hasher := sha256.New()
+
 	var temp [8]byte
 	for round := 0; round < 1<<power; round++ {
-		km.hasher.Write(salt)
-		km.hasher.Write(password)
-		km.hasher.Write(temp[:])
+		if round&0xfff == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		hasher.Write(salt)
+		hasher.Write(password)
+		hasher.Write(temp[:])
 
 		for i := 0; i < 8; i++ {
 			temp[i]++
@@ -90,13 +145,21 @@ func (km *keyManager) sha256Stretch(power int, salt, password []byte) []byte {
 		}
 	}
 
-	defer km.hasher.Reset()
-	return km.hasher.Sum(nil)
+	return hasher.Sum(nil), nil
 }
 
 // NewAESDecrypter returns a new AES-256 decryptor.
 func NewAESDecrypter(r io.Reader, power int, salt, iv []byte, password string) (*AESDecrypter, error) {
-	key := km.Key(power, salt, password)
+	return NewAESDecrypterContext(context.Background(), r, power, salt, iv, password)
+}
+
+// NewAESDecrypterContext returns a new AES-256 decryptor. Key derivation is
+// abandoned if ctx is done before it completes.
+func NewAESDecrypterContext(ctx context.Context, r io.Reader, power int, salt, iv []byte, password string) (*AESDecrypter, error) {
+	key, err := km.Key(ctx, power, salt, password)
+	if err != nil {
+		return nil, err
+	}
 
 	cb, err := aes.NewCipher(key)
 	if err != nil {
@@ -114,15 +177,17 @@ func NewAESDecrypter(r io.Reader, power int, salt, iv []byte, password string) (
 
 func (d *AESDecrypter) Read(p []byte) (int, error) {
 	for d.rbuf.Len() < len(p) {
-		_, err := d.r.Read(d.buf[:])
-		if err != nil {
+		if _, err := io.ReadFull(d.r, d.buf[:]); err != nil {
+			// return what has already been decrypted before the error
+			if err == io.EOF && d.rbuf.Len() > 0 {
+				break
+			}
 			return 0, err
 		}
 
 		d.cbc.CryptBlocks(d.buf[:], d.buf[:])
 
-		_, err = d.rbuf.Write(d.buf[:])
-		if err != nil {
+		if _, err := d.rbuf.Write(d.buf[:]); err != nil {
 			return 0, err
 		}
 	}
@@ -130,3 +195,115 @@ func (d *AESDecrypter) Read(p []byte) (int, error) {
 	n, err := d.rbuf.Read(p)
 	return n, err
 }
+
+// AESKey is an AES-256 key derived from a password and a random salt, used
+// for encryption. Deriving a key is costly, so a key is typically shared by
+// each AESEncrypter of an archive.
+type AESKey struct {
+	power int
+	salt  []byte
+	cb    cipher.Block
+}
+
+// NewAESKey derives a key from the password using 2^power cycles and a random
+// salt. ErrAESInvalidPower is returned if power is negative or greater than
+// AESMaxPower.
+func NewAESKey(power int, password string) (*AESKey, error) {
+	if power < 0 || power > AESMaxPower {
+		return nil, ErrAESInvalidPower
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	// keys used for encryption aren't cached for decryption
+	key, err := km.derive(context.Background(), power, salt, password)
+	if err != nil {
+		return nil, err
+	}
+
+	cb, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AESKey{power: power, salt: salt, cb: cb}, nil
+}
+
+// Power returns the number of key derivation cycles, as a power of two.
+func (k *AESKey) Power() int {
+	return k.power
+}
+
+// Salt returns the salt used to derive the key.
+func (k *AESKey) Salt() []byte {
+	return k.salt
+}
+
+// AESEncrypter is an AES-256 encryptor.
+type AESEncrypter struct {
+	w   io.Writer
+	cbc cipher.BlockMode
+	iv  []byte
+	buf [aes.BlockSize]byte
+	n   int
+}
+
+// NewAESEncrypter returns a new AES-256 encryptor using key and a random IV.
+// Close must be called to write the final, zero padded, block.
+func NewAESEncrypter(w io.Writer, key *AESKey) (*AESEncrypter, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	return &AESEncrypter{
+		w:   w,
+		cbc: cipher.NewCBCEncrypter(key.cb, iv),
+		iv:  iv,
+	}, nil
+}
+
+// IV returns the initialization vector.
+func (e *AESEncrypter) IV() []byte {
+	return e.iv
+}
+
+func (e *AESEncrypter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n := copy(e.buf[e.n:], p)
+		e.n += n
+		p = p[n:]
+
+		if e.n == len(e.buf) {
+			if err := e.flush(); err != nil {
+				return written, err
+			}
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close encrypts and writes any remaining data, padded with zeros to the
+// block size. It does not close the underlying writer.
+func (e *AESEncrypter) Close() error {
+	if e.n == 0 {
+		return nil
+	}
+	for i := e.n; i < len(e.buf); i++ {
+		e.buf[i] = 0
+	}
+	return e.flush()
+}
+
+func (e *AESEncrypter) flush() error {
+	e.cbc.CryptBlocks(e.buf[:], e.buf[:])
+	e.n = 0
+
+	_, err := e.w.Write(e.buf[:])
+	return err
+}
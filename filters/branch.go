@@ -0,0 +1,388 @@
+package filters
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const branchBufferSize = 1 << 16
+
+// BranchDecoder is a decoder for the simple branch converter filters (BCJ,
+// PPC, IA64, ARM, ARMT, SPARC, ARM64 and RISCV). These filters convert the
+// absolute addresses of branch instructions back to relative addresses.
+type BranchDecoder struct {
+	r       io.Reader
+	convert func(buf []byte, ip uint32) int
+	ip      uint32
+	err     error
+
+	buf       [branchBufferSize]byte
+	start     int
+	converted int
+	end       int
+}
+
+func newBranchDecoder(r io.Reader, startOffset uint32, convert func([]byte, uint32) int) *BranchDecoder {
+	return &BranchDecoder{r: r, ip: startOffset, convert: convert}
+}
+
+func (d *BranchDecoder) Read(p []byte) (int, error) {
+	for d.start == d.converted {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		// move unconverted data to the start of the buffer
+		d.end = copy(d.buf[:], d.buf[d.converted:d.end])
+		d.start, d.converted = 0, 0
+
+		var n int
+		n, d.err = d.r.Read(d.buf[d.end:])
+		d.end += n
+
+		d.converted = d.convert(d.buf[:d.end], d.ip)
+		d.ip += uint32(d.converted)
+
+		// data that is too short to contain a branch is left as is
+		if d.err == io.EOF {
+			d.converted = d.end
+		}
+	}
+
+	n := copy(p, d.buf[d.start:d.converted])
+	d.start += n
+
+	return n, nil
+}
+
+// NewBCJDecoder returns a new x86 BCJ decoder.
+func NewBCJDecoder(r io.Reader, startOffset uint32) (*BranchDecoder, error) {
+	var prevMask uint32
+	prevPos := startOffset - 5
+
+	return newBranchDecoder(r, startOffset, func(buf []byte, ip uint32) int {
+		if len(buf) < 5 {
+			return 0
+		}
+
+		if ip-prevPos > 5 {
+			prevPos = ip - 5
+		}
+
+		var i int
+		for i <= len(buf)-5 {
+			b := buf[i]
+			if b != 0xe8 && b != 0xe9 {
+				i++
+				continue
+			}
+
+			offset := ip + uint32(i) - prevPos
+			prevPos = ip + uint32(i)
+			if offset > 5 {
+				prevMask = 0
+			} else {
+				for j := uint32(0); j < offset; j++ {
+					prevMask &= 0x77
+					prevMask <<= 1
+				}
+			}
+
+			b = buf[i+4]
+			if !bcjTestMSByte(b) || !bcjMaskToAllowed[(prevMask>>1)&7] || prevMask>>1 >= 0x10 {
+				i++
+				prevMask |= 1
+				if bcjTestMSByte(b) {
+					prevMask |= 0x10
+				}
+				continue
+			}
+
+			src := binary.LittleEndian.Uint32(buf[i+1:])
+			var dest uint32
+			for {
+				dest = src - (ip + uint32(i) + 5)
+				if prevMask == 0 {
+					break
+				}
+
+				idx := bcjMaskToBitNumber[prevMask>>1]
+				if !bcjTestMSByte(byte(dest >> (24 - idx*8))) {
+					break
+				}
+				src = dest ^ (1<<(32-idx*8) - 1)
+			}
+
+			dest &= 0x1ffffff
+			if dest&0x1000000 != 0 {
+				dest |= 0xff000000
+			}
+			binary.LittleEndian.PutUint32(buf[i+1:], dest)
+
+			i += 5
+			prevMask = 0
+		}
+
+		return i
+	}), nil
+}
+
+var (
+	bcjMaskToAllowed   = [8]bool{true, true, true, false, true, false, false, false}
+	bcjMaskToBitNumber = [8]uint32{0, 1, 2, 2, 3, 3, 3, 3}
+)
+
+func bcjTestMSByte(b byte) bool {
+	return b == 0 || b == 0xff
+}
+
+// NewPPCDecoder returns a new PowerPC (big-endian) branch converter decoder.
+func NewPPCDecoder(r io.Reader, startOffset uint32) (*BranchDecoder, error) {
+	return newBranchDecoder(r, startOffset, func(buf []byte, ip uint32) int {
+		var i int
+		for i = 0; i+4 <= len(buf); i += 4 {
+			if buf[i]>>2 != 0x12 || buf[i+3]&3 != 1 {
+				continue
+			}
+
+			src := binary.BigEndian.Uint32(buf[i:]) & 0x3fffffc
+			dest := src - (ip + uint32(i))
+			binary.BigEndian.PutUint32(buf[i:], 0x48000000|dest&0x3ffffff|1)
+		}
+		return i
+	}), nil
+}
+
+// NewIA64Decoder returns a new IA-64 (Itanium) branch converter decoder.
+func NewIA64Decoder(r io.Reader, startOffset uint32) (*BranchDecoder, error) {
+	return newBranchDecoder(r, startOffset, func(buf []byte, ip uint32) int {
+		var i int
+		for i = 0; i+16 <= len(buf); i += 16 {
+			mask := ia64BranchTable[buf[i]&0x1f]
+
+			for slot, bitPos := uint32(0), uint32(5); slot < 3; slot, bitPos = slot+1, bitPos+41 {
+				if (mask>>slot)&1 == 0 {
+					continue
+				}
+
+				bytePos := i + int(bitPos>>3)
+				bitRes := bitPos & 7
+
+				var instruction uint64
+				for j := 0; j < 6; j++ {
+					instruction |= uint64(buf[bytePos+j]) << (8 * uint(j))
+				}
+
+				norm := instruction >> bitRes
+				if (norm>>37)&0xf != 0x5 || (norm>>9)&7 != 0 {
+					continue
+				}
+
+				src := uint32((norm >> 13) & 0xfffff)
+				src |= uint32((norm>>36)&1) << 20
+				src <<= 4
+
+				dest := src - (ip + uint32(i))
+				dest >>= 4
+
+				norm &^= uint64(0x8fffff) << 13
+				norm |= uint64(dest&0xfffff) << 13
+				norm |= uint64(dest&0x100000) << (36 - 20)
+
+				instruction &= 1<<bitRes - 1
+				instruction |= norm << bitRes
+
+				for j := 0; j < 6; j++ {
+					buf[bytePos+j] = byte(instruction >> (8 * uint(j)))
+				}
+			}
+		}
+		return i
+	}), nil
+}
+
+var ia64BranchTable = [32]uint32{
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0,
+	4, 4, 6, 6, 0, 0, 7, 7,
+	4, 4, 0, 0, 4, 4, 0, 0,
+}
+
+// NewARMDecoder returns a new ARM (little-endian) branch converter decoder.
+func NewARMDecoder(r io.Reader, startOffset uint32) (*BranchDecoder, error) {
+	return newBranchDecoder(r, startOffset, func(buf []byte, ip uint32) int {
+		var i int
+		for i = 0; i+4 <= len(buf); i += 4 {
+			if buf[i+3] != 0xeb {
+				continue
+			}
+
+			src := uint32(buf[i+2])<<16 | uint32(buf[i+1])<<8 | uint32(buf[i])
+			src <<= 2
+
+			dest := src - (ip + uint32(i) + 8)
+			dest >>= 2
+
+			buf[i+2] = byte(dest >> 16)
+			buf[i+1] = byte(dest >> 8)
+			buf[i] = byte(dest)
+		}
+		return i
+	}), nil
+}
+
+// NewARMTDecoder returns a new ARM Thumb (little-endian) branch converter
+// decoder.
+func NewARMTDecoder(r io.Reader, startOffset uint32) (*BranchDecoder, error) {
+	return newBranchDecoder(r, startOffset, func(buf []byte, ip uint32) int {
+		var i int
+		for i = 0; i+4 <= len(buf); i += 2 {
+			if buf[i+1]&0xf8 != 0xf0 || buf[i+3]&0xf8 != 0xf8 {
+				continue
+			}
+
+			src := (uint32(buf[i+1])&7)<<19 | uint32(buf[i])<<11 | (uint32(buf[i+3])&7)<<8 | uint32(buf[i+2])
+			src <<= 1
+
+			dest := src - (ip + uint32(i) + 4)
+			dest >>= 1
+
+			buf[i+1] = 0xf0 | byte((dest>>19)&7)
+			buf[i] = byte(dest >> 11)
+			buf[i+3] = 0xf8 | byte((dest>>8)&7)
+			buf[i+2] = byte(dest)
+
+			i += 2
+		}
+		return i
+	}), nil
+}
+
+// NewSPARCDecoder returns a new SPARC branch converter decoder.
+func NewSPARCDecoder(r io.Reader, startOffset uint32) (*BranchDecoder, error) {
+	return newBranchDecoder(r, startOffset, func(buf []byte, ip uint32) int {
+		var i int
+		for i = 0; i+4 <= len(buf); i += 4 {
+			if !(buf[i] == 0x40 && buf[i+1]&0xc0 == 0) && !(buf[i] == 0x7f && buf[i+1]&0xc0 == 0xc0) {
+				continue
+			}
+
+			src := binary.BigEndian.Uint32(buf[i:])
+			src <<= 2
+
+			dest := src - (ip + uint32(i))
+			dest >>= 2
+			dest = ((0-((dest>>22)&1))<<22)&0x3fffffff | dest&0x3fffff | 0x40000000
+
+			binary.BigEndian.PutUint32(buf[i:], dest)
+		}
+		return i
+	}), nil
+}
+
+// NewARM64Decoder returns a new ARM64 branch converter decoder.
+func NewARM64Decoder(r io.Reader, startOffset uint32) (*BranchDecoder, error) {
+	return newBranchDecoder(r, startOffset, func(buf []byte, ip uint32) int {
+		var i int
+		for i = 0; i+4 <= len(buf); i += 4 {
+			pc := ip + uint32(i)
+			instr := binary.LittleEndian.Uint32(buf[i:])
+
+			switch {
+			case instr>>26 == 0x25: // BL
+				instr = 0x94000000 | (instr-pc>>2)&0x3ffffff
+
+			case instr&0x9f000000 == 0x90000000: // ADRP
+				src := (instr>>29)&3 | (instr>>3)&0x1ffffc
+				if (src+0x20000)&0x1c0000 != 0 {
+					continue
+				}
+
+				dest := src - pc>>12
+				instr &= 0x9000001f
+				instr |= (dest & 3) << 29
+				instr |= (dest & 0x3fffc) << 3
+				instr |= (0 - (dest & 0x20000)) & 0xe00000
+
+			default:
+				continue
+			}
+
+			binary.LittleEndian.PutUint32(buf[i:], instr)
+		}
+		return i
+	}), nil
+}
+
+// NewRISCVDecoder returns a new RISC-V branch converter decoder.
+func NewRISCVDecoder(r io.Reader, startOffset uint32) (*BranchDecoder, error) {
+	return newBranchDecoder(r, startOffset, func(buf []byte, ip uint32) int {
+		if len(buf) < 8 {
+			return 0
+		}
+
+		var i int
+		for i = 0; i <= len(buf)-8; i += 2 {
+			inst := uint32(buf[i])
+
+			if inst == 0xef { // JAL
+				b1 := uint32(buf[i+1])
+				if b1&0x0d != 0 {
+					continue
+				}
+				b2 := uint32(buf[i+2])
+				b3 := uint32(buf[i+3])
+
+				addr := (b1&0xf0)<<13 | b2<<9 | b3<<1
+				addr -= ip + uint32(i)
+
+				buf[i+1] = byte(b1&0x0f | (addr>>8)&0xf0)
+				buf[i+2] = byte((addr>>16)&0x0f | (addr>>7)&0x10 | (addr<<4)&0xe0)
+				buf[i+3] = byte((addr>>4)&0x7f | (addr>>13)&0x80)
+
+				i += 4 - 2
+				continue
+			}
+
+			if inst&0x7f != 0x17 { // AUIPC
+				continue
+			}
+
+			inst = binary.LittleEndian.Uint32(buf[i:])
+
+			var inst2 uint32
+			if inst&0xe80 != 0 {
+				// AUIPC's rd isn't x0 or x2, so this is an unconverted pair
+				inst2 = binary.LittleEndian.Uint32(buf[i+4:])
+				if ((inst<<8)^(inst2-3))&0xf8003 != 0 {
+					i += 6 - 2
+					continue
+				}
+
+				addr := inst & 0xfffff000
+				addr += inst2 >> 20
+
+				inst = 0x17 | 2<<7 | inst2<<12
+				inst2 = addr
+			} else {
+				rs1 := inst >> 27
+				if (inst-0x3117)<<18 >= rs1&0x1d {
+					i += 4 - 2
+					continue
+				}
+
+				addr := binary.BigEndian.Uint32(buf[i+4:])
+				addr -= ip + uint32(i)
+
+				inst2 = inst>>12 | addr<<20
+				inst = 0x17 | rs1<<7 | (addr+0x800)&0xfffff000
+			}
+
+			binary.LittleEndian.PutUint32(buf[i:], inst)
+			binary.LittleEndian.PutUint32(buf[i+4:], inst2)
+
+			i += 8 - 2
+		}
+		return i
+	}), nil
+}
@@ -0,0 +1,104 @@
+package filters
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Brotli streams, as written by 7-Zip-zstd. When compressing with multiple
+// threads, 7-Zip-zstd splits the input into several Brotli streams, each
+// preceded by a skippable frame holding its compressed size. Otherwise, a
+// single Brotli stream is written without a frame.
+
+const (
+	brotliFrameMagic = 0x184d2a50
+	brotliFrameSize  = 8
+	brotliMagic      = 0x5242 // "BR"
+
+	// frame magic, frame size, compressed size, brotli magic and the
+	// uncompressed size in 64KiB units
+	brotliFrameHeaderSize = 4 + 4 + 4 + 2 + 2
+)
+
+// ErrBrotliDataError is returned when a Brotli stream is followed by data that
+// isn't another framed stream.
+var ErrBrotliDataError = errors.New("brotli data error")
+
+// BrotliDecoder is a Brotli decoder.
+type BrotliDecoder struct {
+	r   *bufio.Reader
+	br  *brotli.Reader
+	lr  *io.LimitedReader // the current stream's frame, if it has one
+	cur io.Reader
+	err error
+}
+
+// NewBrotliDecoder returns a new Brotli decoder.
+func NewBrotliDecoder(r io.Reader) (*BrotliDecoder, error) {
+	return &BrotliDecoder{r: bufio.NewReader(r)}, nil
+}
+
+func (d *BrotliDecoder) Read(p []byte) (int, error) {
+	for {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		if d.cur == nil {
+			d.cur, d.err = d.next()
+			continue
+		}
+
+		n, err := d.cur.Read(p)
+		if err == io.EOF {
+			// skip anything in the frame following the stream
+			if d.lr != nil {
+				_, err = io.Copy(ioutil.Discard, d.lr)
+			} else {
+				err = nil
+			}
+			d.cur = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// next returns a reader for the next Brotli stream.
+func (d *BrotliDecoder) next() (io.Reader, error) {
+	header, err := d.r.Peek(brotliFrameHeaderSize)
+	if len(header) == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+
+	var r io.Reader = d.r
+	switch {
+	case len(header) == brotliFrameHeaderSize &&
+		binary.LittleEndian.Uint32(header) == brotliFrameMagic &&
+		binary.LittleEndian.Uint32(header[4:]) == brotliFrameSize &&
+		binary.LittleEndian.Uint16(header[12:]) == brotliMagic:
+		size := binary.LittleEndian.Uint32(header[8:])
+		d.r.Discard(brotliFrameHeaderSize)
+
+		d.lr = &io.LimitedReader{R: d.r, N: int64(size)}
+		r = d.lr
+
+	case d.br != nil:
+		// only a lone stream is written without a frame
+		return nil, ErrBrotliDataError
+	}
+
+	if d.br == nil {
+		d.br = brotli.NewReader(r)
+	} else if err := d.br.Reset(r); err != nil {
+		return nil, err
+	}
+
+	return d.br, nil
+}
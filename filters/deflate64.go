@@ -0,0 +1,424 @@
+package filters
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Deflate64, also known as enhanced deflate, is deflate with a 64KiB window.
+// Length code 285 takes 16 extra bits rather than always being 258, and
+// distance codes 30 and 31 are valid, reaching back the full window.
+
+const (
+	deflate64WindowSize = 1 << 16
+	deflate64MaxBits    = 15
+	deflate64MaxLitLen  = 288
+	deflate64MaxDist    = 32
+	deflate64EndOfBlock = 256
+)
+
+// ErrDeflate64DataError is returned when a Deflate64 stream is corrupt.
+var ErrDeflate64DataError = errors.New("deflate64 data error")
+
+var (
+	deflate64LengthBase = [29]uint16{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+		35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 3,
+	}
+	deflate64LengthExtra = [29]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+		3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 16,
+	}
+	deflate64DistBase = [32]uint32{
+		1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+		257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577, 32769, 49153,
+	}
+	deflate64DistExtra = [32]uint8{
+		0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+		7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13, 14, 14,
+	}
+
+	// order the code length code lengths are stored in
+	deflate64CodeLengthOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+	deflate64FixedLitLen, deflate64FixedDist huffman
+)
+
+func init() {
+	var lengths [deflate64MaxLitLen]uint8
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	deflate64FixedLitLen.init(lengths[:])
+
+	for i := 0; i < deflate64MaxDist; i++ {
+		lengths[i] = 5
+	}
+	deflate64FixedDist.init(lengths[:deflate64MaxDist])
+}
+
+// huffman is a canonical Huffman code, decoded a bit at a time by counting
+// the codes of each length.
+type huffman struct {
+	count  [deflate64MaxBits + 1]uint16
+	symbol [deflate64MaxLitLen]uint16
+}
+
+// init builds the code from the code length of each symbol, returning false
+// if the lengths are over-subscribed.
+func (h *huffman) init(lengths []uint8) bool {
+	h.count = [deflate64MaxBits + 1]uint16{}
+	for _, length := range lengths {
+		h.count[length]++
+	}
+
+	left := 1
+	for length := 1; length <= deflate64MaxBits; length++ {
+		left <<= 1
+		left -= int(h.count[length])
+		if left < 0 {
+			return false
+		}
+	}
+
+	var offs [deflate64MaxBits + 1]uint16
+	for length := 1; length < deflate64MaxBits; length++ {
+		offs[length+1] = offs[length] + h.count[length]
+	}
+	for symbol, length := range lengths {
+		if length != 0 {
+			h.symbol[offs[length]] = uint16(symbol)
+			offs[length]++
+		}
+	}
+
+	return true
+}
+
+// Deflate64Decoder is a Deflate64 decoder.
+type Deflate64Decoder struct {
+	r     *bufio.Reader
+	bits  uint32
+	nbits uint
+	err   error
+
+	final   bool
+	inBlock bool
+	stored  int // bytes remaining of a stored block, or -1
+
+	litLen, dist *huffman
+	dynLitLen    huffman
+	dynDist      huffman
+
+	// an unfinished match
+	copyLen  int
+	copyDist int
+
+	window  [deflate64WindowSize]byte
+	pos     int
+	written int
+}
+
+// NewDeflate64Decoder returns a new Deflate64 decoder.
+func NewDeflate64Decoder(r io.Reader) (*Deflate64Decoder, error) {
+	return &Deflate64Decoder{r: bufio.NewReader(r)}, nil
+}
+
+func (d *Deflate64Decoder) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && d.err == nil {
+		var m int
+		m, d.err = d.decode(p[n:])
+		n += m
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, d.err
+}
+
+// decode decodes into p, returning the number of bytes written.
+func (d *Deflate64Decoder) decode(p []byte) (int, error) {
+	if d.copyLen > 0 {
+		return d.copy(p), nil
+	}
+
+	if !d.inBlock {
+		if d.final {
+			return 0, io.EOF
+		}
+		return 0, d.readBlockHeader()
+	}
+
+	if d.stored >= 0 {
+		return d.readStored(p)
+	}
+
+	n := 0
+	for n < len(p) {
+		symbol, err := d.decodeSymbol(d.litLen)
+		if err != nil {
+			return n, err
+		}
+
+		switch {
+		case symbol < 256:
+			p[n] = byte(symbol)
+			d.put(p[n])
+			n++
+			continue
+
+		case symbol == deflate64EndOfBlock:
+			d.inBlock = false
+			return n, nil
+		}
+
+		symbol -= 257
+		if int(symbol) >= len(deflate64LengthBase) {
+			return n, ErrDeflate64DataError
+		}
+		extra, err := d.readBits(uint(deflate64LengthExtra[symbol]))
+		if err != nil {
+			return n, err
+		}
+		length := int(deflate64LengthBase[symbol]) + int(extra)
+
+		symbol, err = d.decodeSymbol(d.dist)
+		if err != nil {
+			return n, err
+		}
+		if int(symbol) >= len(deflate64DistBase) {
+			return n, ErrDeflate64DataError
+		}
+		extra, err = d.readBits(uint(deflate64DistExtra[symbol]))
+		if err != nil {
+			return n, err
+		}
+		dist := int(deflate64DistBase[symbol]) + int(extra)
+		if dist > d.written {
+			return n, ErrDeflate64DataError
+		}
+
+		d.copyLen, d.copyDist = length, dist
+		n += d.copy(p[n:])
+	}
+
+	return n, nil
+}
+
+// copy copies as much of the current match as fits into p.
+func (d *Deflate64Decoder) copy(p []byte) int {
+	n := d.copyLen
+	if n > len(p) {
+		n = len(p)
+	}
+	for i := 0; i < n; i++ {
+		p[i] = d.window[(d.pos-d.copyDist)&(deflate64WindowSize-1)]
+		d.put(p[i])
+	}
+	d.copyLen -= n
+	return n
+}
+
+func (d *Deflate64Decoder) put(b byte) {
+	d.window[d.pos] = b
+	d.pos = (d.pos + 1) & (deflate64WindowSize - 1)
+	if d.written < deflate64WindowSize {
+		d.written++
+	}
+}
+
+func (d *Deflate64Decoder) readBlockHeader() error {
+	header, err := d.readBits(3)
+	if err != nil {
+		return err
+	}
+
+	d.final = header&1 == 1
+	d.inBlock = true
+	d.stored = -1
+
+	switch header >> 1 {
+	case 0:
+		// stored blocks start at a byte boundary
+		d.bits, d.nbits = 0, 0
+
+		size, err := d.readBits(16)
+		if err != nil {
+			return err
+		}
+		nsize, err := d.readBits(16)
+		if err != nil {
+			return err
+		}
+		if size != ^nsize&0xffff {
+			return ErrDeflate64DataError
+		}
+		d.stored = int(size)
+
+	case 1:
+		d.litLen, d.dist = &deflate64FixedLitLen, &deflate64FixedDist
+
+	case 2:
+		d.litLen, d.dist = &d.dynLitLen, &d.dynDist
+		return d.readDynamicTables()
+
+	default:
+		return ErrDeflate64DataError
+	}
+
+	return nil
+}
+
+func (d *Deflate64Decoder) readStored(p []byte) (int, error) {
+	if d.stored == 0 {
+		d.inBlock = false
+		return 0, nil
+	}
+
+	if len(p) > d.stored {
+		p = p[:d.stored]
+	}
+	n, err := d.r.Read(p)
+	for _, b := range p[:n] {
+		d.put(b)
+	}
+	d.stored -= n
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (d *Deflate64Decoder) readDynamicTables() error {
+	counts, err := d.readBits(14)
+	if err != nil {
+		return err
+	}
+	nlen := int(counts&0x1f) + 257
+	ndist := int(counts>>5&0x1f) + 1
+	ncode := int(counts>>10) + 4
+	if nlen > deflate64MaxLitLen-2 {
+		return ErrDeflate64DataError
+	}
+
+	var lengths [deflate64MaxLitLen + deflate64MaxDist]uint8
+	for i := 0; i < ncode; i++ {
+		length, err := d.readBits(3)
+		if err != nil {
+			return err
+		}
+		lengths[deflate64CodeLengthOrder[i]] = uint8(length)
+	}
+
+	var lencode huffman
+	if !lencode.init(lengths[:19]) {
+		return ErrDeflate64DataError
+	}
+
+	for i := 0; i < nlen+ndist; {
+		symbol, err := d.decodeSymbol(&lencode)
+		if err != nil {
+			return err
+		}
+
+		if symbol < 16 {
+			lengths[i] = uint8(symbol)
+			i++
+			continue
+		}
+
+		var length uint8
+		var repeat uint32
+		switch symbol {
+		case 16:
+			if i == 0 {
+				return ErrDeflate64DataError
+			}
+			length = lengths[i-1]
+			repeat, err = d.readBits(2)
+			repeat += 3
+		case 17:
+			repeat, err = d.readBits(3)
+			repeat += 3
+		default:
+			repeat, err = d.readBits(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+
+		if i+int(repeat) > nlen+ndist {
+			return ErrDeflate64DataError
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[i] = length
+			i++
+		}
+	}
+
+	// the end of block code is required
+	if lengths[deflate64EndOfBlock] == 0 {
+		return ErrDeflate64DataError
+	}
+
+	if !d.dynLitLen.init(lengths[:nlen]) || !d.dynDist.init(lengths[nlen:nlen+ndist]) {
+		return ErrDeflate64DataError
+	}
+
+	return nil
+}
+
+func (d *Deflate64Decoder) decodeSymbol(h *huffman) (uint16, error) {
+	var code, first, index int
+	for length := 1; length <= deflate64MaxBits; length++ {
+		bit, err := d.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+
+		code |= int(bit)
+		count := int(h.count[length])
+		if code-count < first {
+			return h.symbol[index+code-first], nil
+		}
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+
+	// an incomplete code was used
+	return 0, ErrDeflate64DataError
+}
+
+func (d *Deflate64Decoder) readBits(n uint) (uint32, error) {
+	for d.nbits < n {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		d.bits |= uint32(b) << d.nbits
+		d.nbits += 8
+	}
+
+	v := d.bits & (1<<n - 1)
+	d.bits >>= n
+	d.nbits -= n
+	return v, nil
+}
@@ -0,0 +1,328 @@
+package filters
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/huff0"
+)
+
+// Lizard v1.0 frames, as written by 7-Zip-zstd. Each block starts with the
+// compression level, which selects the block's codewords, followed by one or
+// more parts. A part is either stored, or split into streams of lengths,
+// 16-bit offsets, 24-bit offsets, tokens and literals, each of which may be
+// Huffman coded.
+//
+// Levels 10-19 and 30-39 use LZ4-like tokens, with the literal length in the
+// low 4 bits and the match length in the high 4 bits. Levels 20-29 and 40-49
+// use the LIZv1 tokens:
+//
+//	1_MMMM_LLL: the last offset, a match length of 0-15+
+//	0_MMMM_LLL: a 16-bit offset, a match length of 4-15+
+//	31:         a 24-bit offset, a match length of 47+
+//	0-30:       a 24-bit offset, a match length of 16-46
+//
+// Lengths are extended from the lengths stream when at their maximum, by a
+// byte, or by a 16 or 24-bit value following a byte of 254 or 255.
+
+const (
+	lizardFrameMagic = 0x184d2206
+	lizardMinLevel   = 10
+	lizardMaxLevel   = 49
+	lizardMinMatch   = 4
+	lizardMaxOffset  = 1 << 24
+
+	lizardFlagLiterals     = 0x01
+	lizardFlagTokens       = 0x02
+	lizardFlagOffset16     = 0x04
+	lizardFlagOffset24     = 0x08
+	lizardFlagLengths      = 0x10
+	lizardFlagUncompressed = 0x80
+)
+
+// ErrLizardDataError is returned when a Lizard stream is corrupt.
+var ErrLizardDataError = errors.New("lizard data error")
+
+var lizardFrames = &lz4Format{
+	magic:        lizardFrameMagic,
+	maxOffset:    lizardMaxOffset,
+	blockMaxSize: lz5BlockMaxSize,
+	decodeBlock:  lizardDecodeBlock,
+	err:          ErrLizardDataError,
+	dictErr:      ErrLizardDataError,
+}
+
+// LizardDecoder is a Lizard frame decoder.
+type LizardDecoder struct {
+	lz4FrameDecoder
+}
+
+// NewLizardDecoder returns a new Lizard decoder reading one or more frames
+// from r.
+func NewLizardDecoder(r io.Reader) (*LizardDecoder, error) {
+	return &LizardDecoder{newLZ4FrameDecoder(r, lizardFrames)}, nil
+}
+
+// lizardStreams are the streams of a compressed part.
+type lizardStreams struct {
+	lengths, offsets16, offsets24, tokens, literals []byte
+}
+
+// lizardDecodeBlock appends the decoded contents of the block src to dst,
+// which holds the history matches can refer to, and returns the extended
+// slice.
+func lizardDecodeBlock(dst, src []byte, max int) ([]byte, error) {
+	if len(src) < 1 || src[0] < lizardMinLevel || src[0] > lizardMaxLevel {
+		return dst, ErrLizardDataError
+	}
+	lz4Tokens := src[0]/10 == 1 || src[0]/10 == 3
+
+	var lastOffset int
+	for i := 1; i < len(src); {
+		flags := src[i]
+		i++
+
+		if flags == lizardFlagUncompressed {
+			if i+3 > len(src) {
+				return dst, ErrLizardDataError
+			}
+			length := lizardUint24(src[i:])
+			i += 3
+
+			if length > len(src)-i || len(dst)+length > max {
+				return dst, ErrLizardDataError
+			}
+			dst = append(dst, src[i:i+length]...)
+			i += length
+			continue
+		}
+
+		// the lengths stream is never Huffman coded
+		if flags&lizardFlagLengths != 0 {
+			return dst, ErrLizardDataError
+		}
+
+		var s lizardStreams
+		for _, stream := range []struct {
+			data *[]byte
+			flag byte
+		}{
+			{&s.lengths, 0},
+			{&s.offsets16, lizardFlagOffset16},
+			{&s.offsets24, lizardFlagOffset24},
+			{&s.tokens, lizardFlagTokens},
+			{&s.literals, lizardFlagLiterals},
+		} {
+			data, n, err := lizardReadStream(src[i:], flags&stream.flag != 0)
+			if err != nil {
+				return dst, err
+			}
+			*stream.data = data
+			i += n
+		}
+
+		var err error
+		if lz4Tokens {
+			dst, err = lizardDecodeLZ4(dst, &s, max)
+		} else {
+			dst, lastOffset, err = lizardDecodeLIZv1(dst, &s, lastOffset, max)
+		}
+		if err != nil {
+			return dst, err
+		}
+	}
+
+	return dst, nil
+}
+
+// lizardReadStream returns a stream read from the start of src, and the number
+// of bytes read.
+func lizardReadStream(src []byte, huffman bool) ([]byte, int, error) {
+	if !huffman {
+		if len(src) < 3 {
+			return nil, 0, ErrLizardDataError
+		}
+		length := lizardUint24(src)
+		if length > len(src)-3 {
+			return nil, 0, ErrLizardDataError
+		}
+		return src[3 : 3+length], 3 + length, nil
+	}
+
+	if len(src) < 6 {
+		return nil, 0, ErrLizardDataError
+	}
+	length, compressed := lizardUint24(src), lizardUint24(src[3:])
+	if compressed > len(src)-6 {
+		return nil, 0, ErrLizardDataError
+	}
+	src = src[6 : 6+compressed]
+
+	// streams that don't compress are stored, and single symbols repeated
+	switch {
+	case length == 0 || length > huff0.BlockSizeMax || compressed > length:
+		return nil, 0, ErrLizardDataError
+	case compressed == length:
+		return src, 6 + compressed, nil
+	case compressed == 1:
+		return bytes.Repeat(src, length), 6 + compressed, nil
+	}
+
+	s, remain, err := huff0.ReadTable(src, nil)
+	if err != nil {
+		return nil, 0, ErrLizardDataError
+	}
+	data, err := s.Decoder().Decompress4X(make([]byte, 0, length), remain)
+	if err != nil || len(data) != length {
+		return nil, 0, ErrLizardDataError
+	}
+	return data, 6 + compressed, nil
+}
+
+// lizardDecodeLZ4 decodes a part's sequences using LZ4-like tokens.
+func lizardDecodeLZ4(dst []byte, s *lizardStreams, max int) ([]byte, error) {
+	for _, token := range s.tokens {
+		length, ok := lizardLength(s, int(token&0x0f), 0x0f)
+		if !ok {
+			return dst, ErrLizardDataError
+		}
+		if dst, ok = lizardLiterals(dst, s, length, max); !ok {
+			return dst, ErrLizardDataError
+		}
+
+		if len(s.offsets16) < 2 {
+			return dst, ErrLizardDataError
+		}
+		offset := int(s.offsets16[0]) | int(s.offsets16[1])<<8
+		s.offsets16 = s.offsets16[2:]
+
+		length, ok = lizardLength(s, int(token>>4), 0x0f)
+		if !ok {
+			return dst, ErrLizardDataError
+		}
+		length += lizardMinMatch
+
+		if offset == 0 || offset > len(dst) || len(dst)+length > max {
+			return dst, ErrLizardDataError
+		}
+		dst = lz4AppendMatch(dst, offset, length)
+	}
+
+	// the remaining literals follow the last match
+	dst, ok := lizardLiterals(dst, s, len(s.literals), max)
+	if !ok {
+		return dst, ErrLizardDataError
+	}
+	return dst, nil
+}
+
+// lizardDecodeLIZv1 decodes a part's sequences using LIZv1 tokens. The last
+// offset used is carried between the parts of a block.
+func lizardDecodeLIZv1(dst []byte, s *lizardStreams, lastOffset, max int) ([]byte, int, error) {
+	for _, token := range s.tokens {
+		var length int
+		var ok bool
+
+		switch {
+		case token >= 32:
+			if length, ok = lizardLength(s, int(token&0x07), 0x07); !ok {
+				return dst, lastOffset, ErrLizardDataError
+			}
+			if dst, ok = lizardLiterals(dst, s, length, max); !ok {
+				return dst, lastOffset, ErrLizardDataError
+			}
+
+			if token&0x80 == 0 {
+				if len(s.offsets16) < 2 {
+					return dst, lastOffset, ErrLizardDataError
+				}
+				lastOffset = int(s.offsets16[0]) | int(s.offsets16[1])<<8
+				s.offsets16 = s.offsets16[2:]
+			}
+
+			if length, ok = lizardLength(s, int(token>>3&0x0f), 0x0f); !ok {
+				return dst, lastOffset, ErrLizardDataError
+			}
+
+		default:
+			length = int(token) + 16
+			if token == 31 {
+				if length, ok = lizardLength(s, 31, 31); !ok {
+					return dst, lastOffset, ErrLizardDataError
+				}
+				length += 16
+			}
+
+			if len(s.offsets24) < 3 {
+				return dst, lastOffset, ErrLizardDataError
+			}
+			lastOffset = lizardUint24(s.offsets24)
+			s.offsets24 = s.offsets24[3:]
+		}
+
+		// a repeated offset with no match is a run of literals
+		if length == 0 {
+			continue
+		}
+		if lastOffset == 0 || lastOffset > len(dst) || len(dst)+length > max {
+			return dst, lastOffset, ErrLizardDataError
+		}
+		dst = lz4AppendMatch(dst, lastOffset, length)
+	}
+
+	// the remaining literals follow the last match
+	dst, ok := lizardLiterals(dst, s, len(s.literals), max)
+	if !ok {
+		return dst, lastOffset, ErrLizardDataError
+	}
+	return dst, lastOffset, nil
+}
+
+// lizardLiterals appends length literals to dst.
+func lizardLiterals(dst []byte, s *lizardStreams, length, max int) ([]byte, bool) {
+	if length > len(s.literals) || len(dst)+length > max {
+		return dst, false
+	}
+	dst = append(dst, s.literals[:length]...)
+	s.literals = s.literals[length:]
+	return dst, true
+}
+
+// lizardLength returns a literal or match length given its value from the
+// token, reading an additional length from the lengths stream if it's the
+// maximum the token can hold.
+func lizardLength(s *lizardStreams, length, max int) (int, bool) {
+	if length != max {
+		return length, true
+	}
+	if len(s.lengths) < 1 {
+		return 0, false
+	}
+
+	n := 1
+	switch s.lengths[0] {
+	case 254:
+		n = 3
+	case 255:
+		n = 4
+	}
+	if len(s.lengths) < n {
+		return 0, false
+	}
+
+	switch n {
+	case 1:
+		length += int(s.lengths[0])
+	case 3:
+		length += int(s.lengths[1]) | int(s.lengths[2])<<8
+	default:
+		length += lizardUint24(s.lengths[1:])
+	}
+	s.lengths = s.lengths[n:]
+	return length, true
+}
+
+func lizardUint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
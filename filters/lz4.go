@@ -0,0 +1,317 @@
+package filters
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// LZ4 frames, as written by lz4 and by 7-Zip-zstd. When compressing with
+// multiple threads, 7-Zip-zstd precedes each frame with a skippable frame
+// holding its compressed size, which the decoder skips. The frame, block and
+// content checksums aren't verified, as the 7z CRCs cover the same data.
+//
+// The fork's LZ5 and Lizard codecs use the same frames, with their own magic
+// numbers, block sizes and block formats.
+
+const (
+	lz4FrameMagic        = 0x184d2204
+	lz4SkippableMagic    = 0x184d2a50
+	lz4SkippableMask     = 0xfffffff0
+	lz4MinMatch          = 4
+	lz4MaxOffset         = 64 << 10
+	lz4BlockUncompressed = 0x80000000
+)
+
+var (
+	// ErrLZ4DataError is returned when an LZ4 stream is corrupt.
+	ErrLZ4DataError = errors.New("lz4 data error")
+
+	// ErrLZ4DictionaryNotSupported is returned when an LZ4 frame requires a
+	// preset dictionary.
+	ErrLZ4DictionaryNotSupported = errors.New("lz4 dictionaries not supported")
+)
+
+// lz4Format describes a frame format of the LZ4 family.
+type lz4Format struct {
+	magic     uint32
+	maxOffset int // the history linked blocks can refer to
+
+	// blockMaxSize returns the maximum block size for a frame's block size
+	// id, or zero if the id is invalid.
+	blockMaxSize func(id byte) int
+
+	// decodeBlock appends the decoded contents of a block to dst, which
+	// holds the history matches can refer to, up to a length of max.
+	decodeBlock func(dst, src []byte, max int) ([]byte, error)
+
+	err     error // returned for corrupt streams
+	dictErr error // returned for frames requiring a preset dictionary
+}
+
+var lz4Frames = &lz4Format{
+	magic:     lz4FrameMagic,
+	maxOffset: lz4MaxOffset,
+	blockMaxSize: func(id byte) int {
+		if id < 4 {
+			return 0
+		}
+		return 1 << (2*id + 8)
+	},
+	decodeBlock: lz4DecodeBlock,
+	err:         ErrLZ4DataError,
+	dictErr:     ErrLZ4DictionaryNotSupported,
+}
+
+// LZ4Decoder is an LZ4 frame decoder.
+type LZ4Decoder struct {
+	lz4FrameDecoder
+}
+
+// NewLZ4Decoder returns a new LZ4 decoder reading one or more frames from r.
+func NewLZ4Decoder(r io.Reader) (*LZ4Decoder, error) {
+	return &LZ4Decoder{newLZ4FrameDecoder(r, lz4Frames)}, nil
+}
+
+// lz4FrameDecoder decodes the frames of an LZ4 family format.
+type lz4FrameDecoder struct {
+	r      *bufio.Reader
+	format *lz4Format
+	err    error
+
+	inFrame         bool
+	independent     bool
+	blockChecksum   bool
+	contentChecksum bool
+	blockMaxSize    int
+
+	src []byte
+	buf []byte // previous blocks' history, followed by the current block
+	pos int    // position of the unread output in buf
+}
+
+func newLZ4FrameDecoder(r io.Reader, format *lz4Format) lz4FrameDecoder {
+	return lz4FrameDecoder{r: bufio.NewReader(r), format: format}
+}
+
+func (d *lz4FrameDecoder) Read(p []byte) (int, error) {
+	for d.pos == len(d.buf) {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+
+	n := copy(p, d.buf[d.pos:])
+	d.pos += n
+	return n, nil
+}
+
+// next decodes the next block, reading frame headers as needed.
+func (d *lz4FrameDecoder) next() error {
+	if !d.inFrame {
+		var magic uint32
+		if err := binary.Read(d.r, binary.LittleEndian, &magic); err != nil {
+			if err == io.EOF {
+				return io.EOF
+			}
+			return io.ErrUnexpectedEOF
+		}
+
+		switch {
+		case magic&lz4SkippableMask == lz4SkippableMagic:
+			var size uint32
+			if err := binary.Read(d.r, binary.LittleEndian, &size); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			if _, err := d.r.Discard(int(size)); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+
+		case magic == d.format.magic:
+			return d.readFrameDescriptor()
+		}
+
+		return d.format.err
+	}
+
+	var size uint32
+	if err := binary.Read(d.r, binary.LittleEndian, &size); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+
+	// end mark
+	if size == 0 {
+		d.inFrame = false
+		if d.contentChecksum {
+			if _, err := d.r.Discard(4); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+		}
+		return nil
+	}
+
+	uncompressed := size&lz4BlockUncompressed != 0
+	size &^= lz4BlockUncompressed
+	if int(size) > d.blockMaxSize {
+		return d.format.err
+	}
+
+	if cap(d.src) < int(size) {
+		d.src = make([]byte, size)
+	}
+	d.src = d.src[:size]
+	if _, err := io.ReadFull(d.r, d.src); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if d.blockChecksum {
+		if _, err := d.r.Discard(4); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+	}
+
+	// keep the history linked blocks can refer to
+	history := 0
+	if !d.independent {
+		history = len(d.buf)
+		if history > d.format.maxOffset {
+			history = d.format.maxOffset
+		}
+	}
+	copy(d.buf, d.buf[len(d.buf)-history:])
+	d.buf = d.buf[:history]
+	d.pos = history
+
+	if uncompressed {
+		d.buf = append(d.buf, d.src...)
+		return nil
+	}
+
+	var err error
+	d.buf, err = d.format.decodeBlock(d.buf, d.src, history+d.blockMaxSize)
+	return err
+}
+
+func (d *lz4FrameDecoder) readFrameDescriptor() error {
+	var descriptor [2]byte
+	if _, err := io.ReadFull(d.r, descriptor[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+
+	flg, bd := descriptor[0], descriptor[1]
+	if flg>>6 != 1 {
+		return d.format.err
+	}
+	if flg&0x01 != 0 {
+		return d.format.dictErr
+	}
+
+	blockMaxSize := d.format.blockMaxSize((bd >> 4) & 0x07)
+	if blockMaxSize == 0 {
+		return d.format.err
+	}
+
+	d.independent = flg&0x20 != 0
+	d.blockChecksum = flg&0x10 != 0
+	d.contentChecksum = flg&0x04 != 0
+	d.blockMaxSize = blockMaxSize
+
+	// content size, if present, and the header checksum
+	skip := 1
+	if flg&0x08 != 0 {
+		skip += 8
+	}
+	if _, err := d.r.Discard(skip); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+
+	if cap(d.buf) < d.format.maxOffset+d.blockMaxSize {
+		d.buf = make([]byte, 0, d.format.maxOffset+d.blockMaxSize)
+	}
+	d.buf = d.buf[:0]
+	d.pos = 0
+	d.inFrame = true
+
+	return nil
+}
+
+// lz4DecodeBlock appends the decoded contents of the block src to dst, which
+// holds the history matches can refer to, and returns the extended slice.
+func lz4DecodeBlock(dst, src []byte, max int) ([]byte, error) {
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		// literals
+		length, n := lz4Length(src[i:], int(token>>4), 0x0f)
+		if n < 0 {
+			return dst, ErrLZ4DataError
+		}
+		i += n
+
+		if length > len(src)-i || len(dst)+length > max {
+			return dst, ErrLZ4DataError
+		}
+		dst = append(dst, src[i:i+length]...)
+		i += length
+
+		// the last sequence has no match
+		if i == len(src) {
+			break
+		}
+
+		// match
+		if i+2 > len(src) {
+			return dst, ErrLZ4DataError
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+
+		length, n = lz4Length(src[i:], int(token&0x0f), 0x0f)
+		if n < 0 {
+			return dst, ErrLZ4DataError
+		}
+		i += n
+		length += lz4MinMatch
+
+		if offset == 0 || offset > len(dst) || len(dst)+length > max {
+			return dst, ErrLZ4DataError
+		}
+
+		dst = lz4AppendMatch(dst, offset, length)
+	}
+
+	return dst, nil
+}
+
+// lz4AppendMatch appends length bytes copied from offset bytes back in dst.
+// Matches may overlap the bytes they're producing.
+func lz4AppendMatch(dst []byte, offset, length int) []byte {
+	start := len(dst) - offset
+	if offset >= length {
+		return append(dst, dst[start:start+length]...)
+	}
+	for j := 0; j < length; j++ {
+		dst = append(dst, dst[start+j])
+	}
+	return dst
+}
+
+// lz4Length returns a literal or match length given its value from the token,
+// reading additional length bytes from src if it's the maximum the token can
+// hold. The number of bytes read is returned, or -1 if src is too short.
+func lz4Length(src []byte, length, max int) (int, int) {
+	if length != max {
+		return length, 0
+	}
+
+	for i, b := range src {
+		length += int(b)
+		if b != 0xff {
+			return length, i + 1
+		}
+	}
+	return 0, -1
+}
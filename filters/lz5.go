@@ -0,0 +1,129 @@
+package filters
+
+import (
+	"errors"
+	"io"
+)
+
+// LZ5 v1.5 frames, as written by 7-Zip-zstd. Blocks are made of sequences
+// like LZ4's, but the token's top bits select one of four kinds of offset:
+//
+//	1_OO_LL_MMM: a 10-bit offset, with its high bits in the token
+//	00_LLL_MMM:  a 16-bit offset
+//	010_LL_MMM:  a 24-bit offset
+//	011_LL_MMM:  the last offset used
+//
+// L and M are the literal and match lengths, extended by additional bytes as
+// in LZ4 when they hold their maximum value.
+
+const (
+	lz5FrameMagic = 0x184d2205
+	lz5MinMatch   = 3
+	lz5MaxOffset  = 1 << 24
+)
+
+// ErrLZ5DataError is returned when an LZ5 stream is corrupt.
+var ErrLZ5DataError = errors.New("lz5 data error")
+
+var lz5Frames = &lz4Format{
+	magic:        lz5FrameMagic,
+	maxOffset:    lz5MaxOffset,
+	blockMaxSize: lz5BlockMaxSize,
+	decodeBlock:  lz5DecodeBlock,
+	err:          ErrLZ5DataError,
+	dictErr:      ErrLZ5DataError,
+}
+
+// LZ5Decoder is an LZ5 frame decoder.
+type LZ5Decoder struct {
+	lz4FrameDecoder
+}
+
+// NewLZ5Decoder returns a new LZ5 decoder reading one or more frames from r.
+func NewLZ5Decoder(r io.Reader) (*LZ5Decoder, error) {
+	return &LZ5Decoder{newLZ4FrameDecoder(r, lz5Frames)}, nil
+}
+
+// lz5BlockMaxSize returns the maximum block size of LZ5 and Lizard frames,
+// which number their sizes from 128 KiB, rather than LZ4's 64 KiB.
+func lz5BlockMaxSize(id byte) int {
+	sizes := [...]int{128 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20, 256 << 20}
+	if id < 1 || int(id) > len(sizes) {
+		return 0
+	}
+	return sizes[id-1]
+}
+
+// lz5DecodeBlock appends the decoded contents of the block src to dst, which
+// holds the history matches can refer to, and returns the extended slice.
+func lz5DecodeBlock(dst, src []byte, max int) ([]byte, error) {
+	var lastOffset int
+
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		// literals, with a 3-bit length for 16-bit offsets and 2-bit otherwise
+		mask := 0x03
+		if token < 0x40 {
+			mask = 0x07
+		}
+		length, n := lz4Length(src[i:], int(token>>3)&mask, mask)
+		if n < 0 {
+			return dst, ErrLZ5DataError
+		}
+		i += n
+
+		if length > len(src)-i || len(dst)+length > max {
+			return dst, ErrLZ5DataError
+		}
+		dst = append(dst, src[i:i+length]...)
+		i += length
+
+		// the last sequence has no match
+		if i == len(src) {
+			break
+		}
+
+		// match
+		offset := lastOffset
+		switch {
+		case token >= 0x80:
+			if i+1 > len(src) {
+				return dst, ErrLZ5DataError
+			}
+			offset = int(token>>5&0x03)<<8 | int(src[i])
+			i++
+
+		case token < 0x40:
+			if i+2 > len(src) {
+				return dst, ErrLZ5DataError
+			}
+			offset = int(src[i]) | int(src[i+1])<<8
+			i += 2
+
+		case token < 0x60:
+			if i+3 > len(src) {
+				return dst, ErrLZ5DataError
+			}
+			offset = int(src[i]) | int(src[i+1])<<8 | int(src[i+2])<<16
+			i += 3
+		}
+		lastOffset = offset
+
+		length, n = lz4Length(src[i:], int(token&0x07), 0x07)
+		if n < 0 {
+			return dst, ErrLZ5DataError
+		}
+		i += n
+		length += lz5MinMatch
+
+		if offset == 0 || offset > len(dst) || len(dst)+length > max {
+			return dst, ErrLZ5DataError
+		}
+
+		dst = lz4AppendMatch(dst, offset, length)
+	}
+
+	return dst, nil
+}
@@ -0,0 +1,800 @@
+package filters
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// LZMA and LZMA2, decoded from 7z coder properties. The decoder follows the
+// reference implementation: a range decoder reading adaptive binary
+// probabilities, with the dictionary as a circular buffer that decoded data
+// is read from.
+
+const (
+	lzmaNumStates          = 12
+	lzmaNumPosBitsMax      = 4
+	lzmaNumPosStatesMax    = 1 << lzmaNumPosBitsMax
+	lzmaNumLenToPosStates  = 4
+	lzmaNumAlignBits       = 4
+	lzmaStartPosModelIndex = 4
+	lzmaEndPosModelIndex   = 14
+	lzmaNumFullDistances   = 1 << (lzmaEndPosModelIndex >> 1)
+	lzmaMatchMinLen        = 2
+	lzmaProbInit           = 1 << 10
+	lzmaMinDictSize        = 1 << 12
+	lzmaInputBufferSize    = 64 << 10
+
+	// the largest amount decoded before decoded data is handed back
+	lzmaMaxDecode = 64 << 10
+)
+
+var (
+	// ErrLZMAInvalidProperties is returned when the properties of an LZMA or
+	// LZMA2 coder are invalid.
+	ErrLZMAInvalidProperties = errors.New("invalid lzma properties")
+
+	// ErrLZMADataError is returned, wrapped in an LZMADataError, when an LZMA
+	// or LZMA2 stream is corrupt.
+	ErrLZMADataError = errors.New("lzma data error")
+)
+
+// LZMADataError is returned when an LZMA or LZMA2 stream is corrupt. Offset is
+// the offset within the compressed stream at which the corruption was
+// detected.
+type LZMADataError struct {
+	Offset int64
+	Reason string
+}
+
+func (e *LZMADataError) Error() string {
+	return fmt.Sprintf("%v at offset %d: %s", ErrLZMADataError, e.Offset, e.Reason)
+}
+
+// Unwrap returns ErrLZMADataError.
+func (e *LZMADataError) Unwrap() error {
+	return ErrLZMADataError
+}
+
+// lzmaInput is the buffered compressed input, tracking the offset of each
+// byte read.
+type lzmaInput struct {
+	r    io.Reader
+	buf  []byte
+	pos  int
+	end  int
+	base int64 // offset of buf[0]
+	err  error
+}
+
+func (in *lzmaInput) offset() int64 {
+	return in.base + int64(in.pos)
+}
+
+func (in *lzmaInput) readByte() byte {
+	if in.pos < in.end {
+		b := in.buf[in.pos]
+		in.pos++
+		return b
+	}
+	return in.fill()
+}
+
+// fill refills the buffer and returns its first byte. Once the input is
+// exhausted, zeros are returned and the error is recorded, to be checked once
+// the current symbol has been decoded.
+func (in *lzmaInput) fill() byte {
+	if in.err != nil {
+		return 0
+	}
+
+	in.base += int64(in.end)
+	in.pos, in.end = 0, 0
+	for in.end == 0 {
+		n, err := in.r.Read(in.buf)
+		in.end = n
+		if n == 0 && err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			in.err = err
+			return 0
+		}
+	}
+
+	in.pos = 1
+	return in.buf[0]
+}
+
+func (in *lzmaInput) dataError(offset int64, reason string) error {
+	return &LZMADataError{Offset: offset, Reason: reason}
+}
+
+// lzmaRangeDecoder is the range decoder.
+type lzmaRangeDecoder struct {
+	in   *lzmaInput
+	rng  uint32
+	code uint32
+}
+
+func (rc *lzmaRangeDecoder) init() error {
+	start := rc.in.offset()
+	rc.rng = 0xffffffff
+	rc.code = 0
+	if rc.in.readByte() != 0 {
+		return rc.in.dataError(start, "invalid range coder header")
+	}
+	for i := 0; i < 4; i++ {
+		rc.code = rc.code<<8 | uint32(rc.in.readByte())
+	}
+	if rc.in.err != nil {
+		return rc.in.err
+	}
+	if rc.code == rc.rng {
+		return rc.in.dataError(start, "invalid range coder header")
+	}
+	return nil
+}
+
+// dataError returns an error for corruption detected when decoding the last
+// byte read.
+func (rc *lzmaRangeDecoder) dataError(reason string) error {
+	return rc.in.dataError(rc.in.offset()-1, reason)
+}
+
+func (rc *lzmaRangeDecoder) bit(p *uint16) uint32 {
+	prob := uint32(*p)
+	bound := (rc.rng >> 11) * prob
+
+	// branch free, as the bits of poorly compressible data are unpredictable
+	var b uint32
+	if rc.code >= bound {
+		b = 1
+	}
+	mask := -b
+	rc.code -= bound & mask
+	rc.rng = bound&^mask | (rc.rng-bound)&mask
+	*p = uint16(prob + ((1<<11-prob)>>5)&^mask - (prob>>5)&mask)
+
+	if rc.rng < 1<<24 {
+		rc.shift()
+	}
+	return b
+}
+
+// shift shifts in the next input byte.
+func (rc *lzmaRangeDecoder) shift() {
+	rc.rng <<= 8
+	rc.code = rc.code<<8 | uint32(rc.in.readByte())
+}
+
+// bitTree decodes n bits, most significant first, from a tree of
+// probabilities.
+func (rc *lzmaRangeDecoder) bitTree(probs []uint16, n uint) uint32 {
+	m := uint32(1)
+	for i := uint(0); i < n; i++ {
+		m = m<<1 | rc.bit(&probs[m])
+	}
+	return m - 1<<n
+}
+
+// reverseBitTree decodes n bits, least significant first, from a tree of
+// probabilities starting at probs[offset+1].
+func (rc *lzmaRangeDecoder) reverseBitTree(probs []uint16, offset int, n uint) uint32 {
+	m := uint32(1)
+	var v uint32
+	for i := uint(0); i < n; i++ {
+		b := rc.bit(&probs[offset+int(m)])
+		m = m<<1 | b
+		v |= b << i
+	}
+	return v
+}
+
+// direct decodes n bits with fixed probabilities.
+func (rc *lzmaRangeDecoder) direct(n uint) uint32 {
+	var v uint32
+	for ; n > 0; n-- {
+		rc.rng >>= 1
+		rc.code -= rc.rng
+		t := 0 - (rc.code >> 31)
+		rc.code += rc.rng & t
+		v = v<<1 + t + 1
+		if rc.rng < 1<<24 {
+			rc.shift()
+		}
+	}
+	return v
+}
+
+// lzmaDict is the dictionary, a circular buffer of the most recently decoded
+// data.
+type lzmaDict struct {
+	buf   []byte
+	pos   int    // position the next byte is written to
+	read  int    // position of the next byte to be read
+	avail int    // number of bytes that can be referred to
+	total uint32 // number of bytes decoded since the dictionary was reset
+}
+
+func (d *lzmaDict) reset() {
+	d.avail = 0
+	d.total = 0
+}
+
+func (d *lzmaDict) put(b byte) {
+	d.buf[d.pos] = b
+	d.pos++
+	d.total++
+	if d.avail < len(d.buf) {
+		d.avail++
+	}
+}
+
+// byteAt returns the byte at distance dist+1 back from the current position.
+func (d *lzmaDict) byteAt(dist uint32) byte {
+	i := d.pos - int(dist) - 1
+	if i < 0 {
+		i += len(d.buf)
+	}
+	return d.buf[i]
+}
+
+// copyMatch copies length bytes from distance dist+1 back, stopping at limit.
+// It returns the number of bytes copied.
+func (d *lzmaDict) copyMatch(dist uint32, length, limit int) int {
+	if length > limit-d.pos {
+		length = limit - d.pos
+	}
+
+	src := d.pos - int(dist) - 1
+	if src < 0 {
+		src += len(d.buf)
+	}
+
+	switch {
+	case length <= int(dist)+1:
+		// the match doesn't repeat any of its own output
+		n := copy(d.buf[d.pos:d.pos+length], d.buf[src:])
+		if n < length {
+			copy(d.buf[d.pos+n:d.pos+length], d.buf)
+		}
+
+	case src < d.pos:
+		// copy the output so far, a whole number of repeats of the distance
+		for n := 0; n < length; {
+			n += copy(d.buf[d.pos+n:d.pos+length], d.buf[src:d.pos+n])
+		}
+
+	default:
+		for i := 0; i < length; i++ {
+			d.buf[d.pos+i] = d.buf[src]
+			src++
+			if src == len(d.buf) {
+				src = 0
+			}
+		}
+	}
+
+	d.pos += length
+	d.total += uint32(length)
+	d.avail += length
+	if d.avail > len(d.buf) {
+		d.avail = len(d.buf)
+	}
+	return length
+}
+
+type lzmaLenDecoder struct {
+	choice  uint16
+	choice2 uint16
+	low     [lzmaNumPosStatesMax][1 << 3]uint16
+	mid     [lzmaNumPosStatesMax][1 << 3]uint16
+	high    [1 << 8]uint16
+}
+
+func (l *lzmaLenDecoder) reset() {
+	l.choice, l.choice2 = lzmaProbInit, lzmaProbInit
+	for i := range l.low {
+		for j := range l.low[i] {
+			l.low[i][j] = lzmaProbInit
+			l.mid[i][j] = lzmaProbInit
+		}
+	}
+	for i := range l.high {
+		l.high[i] = lzmaProbInit
+	}
+}
+
+// decode returns the match length, less lzmaMatchMinLen.
+func (l *lzmaLenDecoder) decode(rc *lzmaRangeDecoder, posState uint32) uint32 {
+	if rc.bit(&l.choice) == 0 {
+		return rc.bitTree(l.low[posState][:], 3)
+	}
+	if rc.bit(&l.choice2) == 0 {
+		return 8 + rc.bitTree(l.mid[posState][:], 3)
+	}
+	return 16 + rc.bitTree(l.high[:], 8)
+}
+
+// lzmaState is the state of the LZMA decoder, shared by LZMA2 chunks.
+type lzmaState struct {
+	rc   lzmaRangeDecoder
+	dict lzmaDict
+
+	lc, lp, pb uint
+
+	state uint32
+	rep   [4]uint32
+
+	isMatch    [lzmaNumStates << lzmaNumPosBitsMax]uint16
+	isRep      [lzmaNumStates]uint16
+	isRepG0    [lzmaNumStates]uint16
+	isRepG1    [lzmaNumStates]uint16
+	isRepG2    [lzmaNumStates]uint16
+	isRep0Long [lzmaNumStates << lzmaNumPosBitsMax]uint16
+	posSlot    [lzmaNumLenToPosStates][1 << 6]uint16
+	posSpecial [lzmaNumFullDistances - lzmaEndPosModelIndex]uint16
+	align      [1 << lzmaNumAlignBits]uint16
+	literal    []uint16
+	lenDec     lzmaLenDecoder
+	repLenDec  lzmaLenDecoder
+
+	// the remainder of a match that didn't fit before the decode limit
+	matchLen int
+
+	// the number of bytes left to decode, or negative if unknown
+	remaining int64
+	eos       bool
+}
+
+// setProperties sets the literal context, literal position and position bits
+// from the first LZMA property byte.
+func (s *lzmaState) setProperties(props byte) error {
+	if props >= 9*5*5 {
+		return ErrLZMAInvalidProperties
+	}
+	s.lc = uint(props % 9)
+	s.lp = uint(props / 9 % 5)
+	s.pb = uint(props / 45)
+
+	size := 0x300 << (s.lc + s.lp)
+	if cap(s.literal) < size {
+		s.literal = make([]uint16, size)
+	}
+	s.literal = s.literal[:size]
+	return nil
+}
+
+func (s *lzmaState) reset() {
+	s.state = 0
+	s.rep = [4]uint32{}
+	s.matchLen = 0
+
+	for _, probs := range [][]uint16{
+		s.isMatch[:], s.isRep[:], s.isRepG0[:], s.isRepG1[:], s.isRepG2[:],
+		s.isRep0Long[:], s.posSpecial[:], s.align[:], s.literal,
+	} {
+		for i := range probs {
+			probs[i] = lzmaProbInit
+		}
+	}
+	for i := range s.posSlot {
+		for j := range s.posSlot[i] {
+			s.posSlot[i][j] = lzmaProbInit
+		}
+	}
+	s.lenDec.reset()
+	s.repLenDec.reset()
+}
+
+// decode decodes until the dictionary reaches limit, the remaining size is
+// decoded or an end marker is found.
+func (s *lzmaState) decode(limit int) error {
+	rc, dict := &s.rc, &s.dict
+	pbMask := uint32(1)<<s.pb - 1
+	lpMask := uint32(1)<<s.lp - 1
+
+	if s.matchLen > 0 {
+		n := dict.copyMatch(s.rep[0], s.matchLen, limit)
+		s.matchLen -= n
+		s.remaining -= int64(n)
+	}
+
+	for dict.pos < limit && s.remaining != 0 && s.matchLen == 0 {
+		posState := dict.total & pbMask
+		state := s.state
+
+		if rc.bit(&s.isMatch[state<<lzmaNumPosBitsMax|posState]) == 0 {
+			var prev uint32
+			if dict.avail > 0 {
+				prev = uint32(dict.byteAt(0))
+			}
+			litState := (dict.total&lpMask)<<s.lc + prev>>(8-s.lc)
+			probs := s.literal[0x300*litState : 0x300*litState+0x300]
+
+			symbol := uint32(1)
+			if state < 7 {
+				for symbol < 0x100 {
+					symbol = symbol<<1 | rc.bit(&probs[symbol])
+				}
+			} else {
+				if s.rep[0] >= uint32(dict.avail) {
+					return rc.dataError("invalid distance")
+				}
+				matchByte := uint32(dict.byteAt(s.rep[0]))
+				offs := uint32(0x100)
+				for symbol < 0x100 {
+					matchByte <<= 1
+					bit := offs
+					offs &= matchByte
+					if rc.bit(&probs[offs+bit+symbol]) == 0 {
+						symbol <<= 1
+						offs ^= bit
+					} else {
+						symbol = symbol<<1 | 1
+					}
+				}
+			}
+			dict.put(byte(symbol))
+			s.remaining--
+
+			switch {
+			case state < 4:
+				s.state = 0
+			case state < 10:
+				s.state = state - 3
+			default:
+				s.state = state - 6
+			}
+
+			if rc.in.err != nil {
+				return rc.in.err
+			}
+			continue
+		}
+
+		var length uint32
+		if rc.bit(&s.isRep[state]) == 0 {
+			// a match with a new distance
+			length = s.lenDec.decode(rc, posState)
+			if state < 7 {
+				s.state = 7
+			} else {
+				s.state = 10
+			}
+
+			dist := s.decodeDistance(length)
+			if dist == 0xffffffff {
+				s.eos = true
+				if rc.in.err != nil {
+					return rc.in.err
+				}
+				return nil
+			}
+			s.rep[3], s.rep[2], s.rep[1], s.rep[0] = s.rep[2], s.rep[1], s.rep[0], dist
+		} else {
+			// a match repeating a recent distance
+			if dict.avail == 0 {
+				return rc.dataError("repeated match without data")
+			}
+
+			if rc.bit(&s.isRepG0[state]) == 0 {
+				if rc.bit(&s.isRep0Long[state<<lzmaNumPosBitsMax|posState]) == 0 {
+					// a single byte at the last distance
+					if state < 7 {
+						s.state = 9
+					} else {
+						s.state = 11
+					}
+					if s.rep[0] >= uint32(dict.avail) {
+						return rc.dataError("invalid distance")
+					}
+					dict.put(dict.byteAt(s.rep[0]))
+					s.remaining--
+
+					if rc.in.err != nil {
+						return rc.in.err
+					}
+					continue
+				}
+			} else {
+				var dist uint32
+				if rc.bit(&s.isRepG1[state]) == 0 {
+					dist = s.rep[1]
+				} else {
+					if rc.bit(&s.isRepG2[state]) == 0 {
+						dist = s.rep[2]
+					} else {
+						dist = s.rep[3]
+						s.rep[3] = s.rep[2]
+					}
+					s.rep[2] = s.rep[1]
+				}
+				s.rep[1] = s.rep[0]
+				s.rep[0] = dist
+			}
+
+			length = s.repLenDec.decode(rc, posState)
+			if state < 7 {
+				s.state = 8
+			} else {
+				s.state = 11
+			}
+		}
+
+		if rc.in.err != nil {
+			return rc.in.err
+		}
+		if s.rep[0] >= uint32(dict.avail) {
+			return rc.dataError("invalid distance")
+		}
+
+		n := s.limitMatch(int(length) + lzmaMatchMinLen)
+		copied := dict.copyMatch(s.rep[0], n, limit)
+		s.matchLen = n - copied
+		s.remaining -= int64(copied)
+	}
+
+	return nil
+}
+
+// limitMatch limits a match length to the remaining size.
+func (s *lzmaState) limitMatch(length int) int {
+	if s.remaining >= 0 && int64(length) > s.remaining {
+		return int(s.remaining)
+	}
+	return length
+}
+
+func (s *lzmaState) decodeDistance(length uint32) uint32 {
+	rc := &s.rc
+
+	lenState := length
+	if lenState > lzmaNumLenToPosStates-1 {
+		lenState = lzmaNumLenToPosStates - 1
+	}
+
+	posSlot := rc.bitTree(s.posSlot[lenState][:], 6)
+	if posSlot < lzmaStartPosModelIndex {
+		return posSlot
+	}
+
+	numDirectBits := uint(posSlot>>1) - 1
+	dist := (2 | posSlot&1) << numDirectBits
+	if posSlot < lzmaEndPosModelIndex {
+		return dist + rc.reverseBitTree(s.posSpecial[:], int(dist-posSlot)-1, numDirectBits)
+	}
+
+	dist += rc.direct(numDirectBits-lzmaNumAlignBits) << lzmaNumAlignBits
+	return dist + rc.reverseBitTree(s.align[:], -1, lzmaNumAlignBits)
+}
+
+// lzmaBufferSize returns the size of the dictionary buffer to allocate: the
+// dictionary size, unless the unpacked size is smaller.
+func lzmaBufferSize(dictSize uint32, unpackSize int64) int {
+	size := int64(dictSize)
+	if unpackSize >= 0 && unpackSize < size {
+		size = unpackSize
+	}
+	if size < lzmaMinDictSize {
+		size = lzmaMinDictSize
+	}
+	return int(size)
+}
+
+// readDict hands back decoded data from the dictionary, calling decode when
+// there is none.
+func readDict(p []byte, dict *lzmaDict, err *error, decode func(limit int) error) (int, error) {
+	for dict.read == dict.pos {
+		if *err != nil {
+			return 0, *err
+		}
+
+		if dict.pos == len(dict.buf) {
+			dict.pos, dict.read = 0, 0
+		}
+
+		limit := dict.pos + lzmaMaxDecode
+		if limit > len(dict.buf) {
+			limit = len(dict.buf)
+		}
+		*err = decode(limit)
+	}
+
+	n := copy(p, dict.buf[dict.read:dict.pos])
+	dict.read += n
+	return n, nil
+}
+
+// LZMADecoder is an LZMA decoder.
+type LZMADecoder struct {
+	s   lzmaState
+	in  lzmaInput
+	err error
+}
+
+// NewLZMADecoder returns a new LZMA decoder. props are the coder's 5 byte
+// properties: the literal and position bits, followed by the dictionary size.
+// unpackSize is the size of the decoded data, or -1 if unknown, in which case
+// the stream must end with an end marker. A stream of known size may also end
+// with an end marker.
+func NewLZMADecoder(r io.Reader, props []byte, unpackSize int64) (*LZMADecoder, error) {
+	if len(props) != 5 {
+		return nil, ErrLZMAInvalidProperties
+	}
+
+	d := &LZMADecoder{in: lzmaInput{r: r, buf: make([]byte, lzmaInputBufferSize)}}
+	if err := d.s.setProperties(props[0]); err != nil {
+		return nil, err
+	}
+	d.s.reset()
+	d.s.rc.in = &d.in
+	d.s.remaining = unpackSize
+	d.s.dict.buf = make([]byte, lzmaBufferSize(binary.LittleEndian.Uint32(props[1:]), unpackSize))
+
+	if unpackSize != 0 {
+		d.err = d.s.rc.init()
+	}
+	return d, nil
+}
+
+func (d *LZMADecoder) Read(p []byte) (int, error) {
+	return readDict(p, &d.s.dict, &d.err, d.decode)
+}
+
+func (d *LZMADecoder) decode(limit int) error {
+	if d.s.remaining == 0 || d.s.eos {
+		return io.EOF
+	}
+	return d.s.decode(limit)
+}
+
+// LZMA2Decoder is an LZMA2 decoder.
+type LZMA2Decoder struct {
+	s   lzmaState
+	in  lzmaInput
+	err error
+
+	// the state of the current chunk
+	uncompressed int // bytes remaining of an uncompressed chunk
+	packedEnd    int64
+	inChunk      bool
+
+	needDictReset bool
+	needProps     bool
+}
+
+// NewLZMA2Decoder returns a new LZMA2 decoder. props is the coder's 1 byte
+// property, the dictionary size. unpackSize is the size of the decoded data,
+// used to limit the dictionary size, or -1 if unknown.
+func NewLZMA2Decoder(r io.Reader, props []byte, unpackSize int64) (*LZMA2Decoder, error) {
+	if len(props) != 1 || props[0] > 40 {
+		return nil, ErrLZMAInvalidProperties
+	}
+
+	dictSize := uint32(0xffffffff)
+	if props[0] < 40 {
+		dictSize = uint32(2|props[0]&1) << (props[0]/2 + 11)
+	}
+
+	d := &LZMA2Decoder{
+		in:            lzmaInput{r: r, buf: make([]byte, lzmaInputBufferSize)},
+		needDictReset: true,
+		needProps:     true,
+	}
+	d.s.rc.in = &d.in
+	d.s.dict.buf = make([]byte, lzmaBufferSize(dictSize, unpackSize))
+	return d, nil
+}
+
+func (d *LZMA2Decoder) Read(p []byte) (int, error) {
+	return readDict(p, &d.s.dict, &d.err, d.decode)
+}
+
+func (d *LZMA2Decoder) decode(limit int) error {
+	if !d.inChunk {
+		return d.readChunkHeader()
+	}
+
+	if d.uncompressed > 0 {
+		n := limit - d.s.dict.pos
+		if n > d.uncompressed {
+			n = d.uncompressed
+		}
+		for i := 0; i < n; i++ {
+			d.s.dict.put(d.in.readByte())
+		}
+		d.uncompressed -= n
+		d.inChunk = d.uncompressed > 0
+		return d.in.err
+	}
+
+	if err := d.s.decode(limit); err != nil {
+		return err
+	}
+	if d.s.eos {
+		return d.s.rc.dataError("unexpected end marker")
+	}
+
+	if d.s.remaining == 0 {
+		if d.in.offset() != d.packedEnd || d.s.rc.code != 0 {
+			return d.s.rc.dataError("chunk size mismatch")
+		}
+		d.inChunk = false
+	}
+	return nil
+}
+
+func (d *LZMA2Decoder) readChunkHeader() error {
+	start := d.in.offset()
+	control := d.in.readByte()
+	if d.in.err != nil {
+		return d.in.err
+	}
+
+	switch {
+	case control == 0x00:
+		return io.EOF
+
+	case control == 0x01 || control == 0x02:
+		if control == 0x01 {
+			d.resetDict()
+		} else if d.needDictReset {
+			return d.in.dataError(start, "missing dictionary reset")
+		}
+
+		d.uncompressed = int(d.in.readByte())<<8 | int(d.in.readByte()) + 1
+		d.inChunk = true
+		return d.in.err
+
+	case control < 0x80:
+		return d.in.dataError(start, "invalid chunk header")
+	}
+
+	// an lzma chunk, which may reset the dictionary, then the properties and
+	// then the state
+	reset := control >> 5 & 0x03
+	switch {
+	case reset == 3:
+		d.resetDict()
+	case d.needDictReset:
+		return d.in.dataError(start, "missing dictionary reset")
+	case reset < 2 && d.needProps:
+		return d.in.dataError(start, "missing properties")
+	}
+
+	unpacked := int64(control&0x1f)<<16 | int64(d.in.readByte())<<8 | int64(d.in.readByte()) + 1
+	packed := int64(d.in.readByte())<<8 | int64(d.in.readByte()) + 1
+
+	if reset >= 2 {
+		props := d.in.readByte()
+		if err := d.s.setProperties(props); err != nil || d.s.lc+d.s.lp > 4 {
+			return d.in.dataError(d.in.offset()-1, "invalid properties")
+		}
+		d.needProps = false
+	}
+	if d.in.err != nil {
+		return d.in.err
+	}
+	if reset >= 1 {
+		d.s.reset()
+	}
+
+	d.packedEnd = d.in.offset() + packed
+	if err := d.s.rc.init(); err != nil {
+		return err
+	}
+	d.s.remaining = unpacked
+	d.inChunk = true
+	return nil
+}
+
+// resetDict resets the dictionary. The properties must then be set by the
+// next lzma chunk.
+func (d *LZMA2Decoder) resetDict() {
+	d.s.dict.reset()
+	d.needDictReset = false
+	d.needProps = true
+}
@@ -0,0 +1,1136 @@
+package filters
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// PPMd variant H, as used by 7-Zip (Ppmd7). The model's memory is a single
+// byte slice and all contexts, states and free list nodes are referenced by
+// their offset within it, mirroring the reference implementation so that
+// memory exhaustion (and the resulting model restarts) happen at exactly the
+// same points as they did during compression.
+
+const (
+	// PPMdMinOrder is the minimum supported model order.
+	PPMdMinOrder = 2
+
+	// PPMdMaxOrder is the maximum supported model order.
+	PPMdMaxOrder = 64
+
+	// PPMdMinMemSize is the minimum supported model memory size.
+	PPMdMinMemSize = 1 << 11
+
+	// PPMdMaxMemSize is the maximum supported model memory size.
+	PPMdMaxMemSize = 0xFFFFFFFF - 12*3
+
+	ppmdMaxFreq    = 124
+	ppmdUnitSize   = 12
+	ppmdNumIndexes = 4 + 4 + 4 + 26
+	ppmdIntBits    = 7
+	ppmdPeriodBits = 7
+	ppmdBinScale   = 1 << (ppmdIntBits + ppmdPeriodBits)
+	ppmdStateSize  = 6
+	ppmdTopValue   = 1 << 24
+)
+
+var (
+	// ErrPPMdInvalidProperties is returned when the order or memory size of a
+	// PPMd stream is outside of the supported range.
+	ErrPPMdInvalidProperties = errors.New("invalid ppmd properties")
+
+	// ErrPPMdDataError is returned when a PPMd stream is corrupt.
+	ErrPPMdDataError = errors.New("ppmd data error")
+)
+
+var (
+	ppmdExpEscape  = [16]byte{25, 14, 9, 7, 5, 5, 4, 4, 4, 3, 3, 3, 2, 2, 2, 2}
+	ppmdInitBinEsc = [8]uint16{0x3CDD, 0x1F3F, 0x59BF, 0x48F3, 0x64A1, 0x5ABC, 0x6632, 0x6051}
+)
+
+type ppmdSee struct {
+	summ  uint16
+	shift byte
+	count byte
+}
+
+func (s *ppmdSee) update() {
+	if s.shift < ppmdPeriodBits {
+		s.count--
+		if s.count == 0 {
+			s.summ <<= 1
+			s.count = byte(3 << s.shift)
+			s.shift++
+		}
+	}
+}
+
+type ppmdState struct {
+	symbol    byte
+	freq      byte
+	successor uint32
+}
+
+type ppmdModel struct {
+	mem         []byte
+	size        uint32
+	alignOffset uint32
+
+	text       uint32
+	unitsStart uint32
+	loUnit     uint32
+	hiUnit     uint32
+	glueCount  uint32
+	freeList   [ppmdNumIndexes]uint32
+
+	indx2Units [ppmdNumIndexes]byte
+	units2Indx [128]byte
+	ns2Indx    [256]byte
+	ns2BSIndx  [256]byte
+	hb2Flag    [256]byte
+
+	minContext uint32
+	maxContext uint32
+	foundState uint32
+
+	orderFall   uint32
+	initEsc     uint32
+	prevSuccess uint32
+	maxOrder    uint32
+	hiBitsFlag  uint32
+	runLength   int32
+	initRL      int32
+
+	binSumm  [128][64]uint16
+	see      [25][16]ppmdSee
+	dummySee ppmdSee
+}
+
+func newPPMdModel(maxOrder int, memSize uint32) *ppmdModel {
+	p := &ppmdModel{}
+
+	k := 0
+	for i := 0; i < ppmdNumIndexes; i++ {
+		step := 4
+		if i < 12 {
+			step = i>>2 + 1
+		}
+		for ; step > 0; step-- {
+			p.units2Indx[k] = byte(i)
+			k++
+		}
+		p.indx2Units[i] = byte(k)
+	}
+
+	p.ns2BSIndx[0] = 0 << 1
+	p.ns2BSIndx[1] = 1 << 1
+	for i := 2; i < 11; i++ {
+		p.ns2BSIndx[i] = 2 << 1
+	}
+	for i := 11; i < 256; i++ {
+		p.ns2BSIndx[i] = 3 << 1
+	}
+
+	for i := 0; i < 3; i++ {
+		p.ns2Indx[i] = byte(i)
+	}
+	m, step := 3, 1
+	for i := 3; i < 256; i++ {
+		p.ns2Indx[i] = byte(m)
+		step--
+		if step == 0 {
+			m++
+			step = m - 2
+		}
+	}
+
+	for i := 0x40; i < 0x100; i++ {
+		p.hb2Flag[i] = 8
+	}
+
+	p.alignOffset = 4 - (memSize & 3)
+	p.size = memSize
+	p.mem = make([]byte, int(p.alignOffset)+int(memSize)+ppmdUnitSize)
+
+	p.maxOrder = uint32(maxOrder)
+	p.restartModel()
+	p.dummySee.shift = ppmdPeriodBits
+	p.dummySee.summ = 0
+	p.dummySee.count = 64
+
+	return p
+}
+
+// memory accessors
+
+func (p *ppmdModel) u16(off uint32) uint32 {
+	return uint32(binary.LittleEndian.Uint16(p.mem[off:]))
+}
+
+func (p *ppmdModel) setU16(off uint32, v uint32) {
+	binary.LittleEndian.PutUint16(p.mem[off:], uint16(v))
+}
+
+func (p *ppmdModel) u32(off uint32) uint32 {
+	return binary.LittleEndian.Uint32(p.mem[off:])
+}
+
+func (p *ppmdModel) setU32(off uint32, v uint32) {
+	binary.LittleEndian.PutUint32(p.mem[off:], v)
+}
+
+// context accessors
+
+func (p *ppmdModel) numStats(ctx uint32) uint32       { return p.u16(ctx) }
+func (p *ppmdModel) setNumStats(ctx uint32, v uint32) { p.setU16(ctx, v) }
+func (p *ppmdModel) summFreq(ctx uint32) uint32       { return p.u16(ctx + 2) }
+func (p *ppmdModel) setSummFreq(ctx uint32, v uint32) { p.setU16(ctx+2, v) }
+func (p *ppmdModel) stats(ctx uint32) uint32          { return p.u32(ctx + 4) }
+func (p *ppmdModel) setStats(ctx uint32, v uint32)    { p.setU32(ctx+4, v) }
+func (p *ppmdModel) suffix(ctx uint32) uint32         { return p.u32(ctx + 8) }
+func (p *ppmdModel) setSuffix(ctx uint32, v uint32)   { p.setU32(ctx+8, v) }
+func (p *ppmdModel) oneState(ctx uint32) uint32       { return ctx + 2 }
+func (p *ppmdModel) symbol(s uint32) uint32           { return uint32(p.mem[s]) }
+func (p *ppmdModel) freq(s uint32) uint32             { return uint32(p.mem[s+1]) }
+func (p *ppmdModel) setFreq(s uint32, v uint32)       { p.mem[s+1] = byte(v) }
+func (p *ppmdModel) successor(s uint32) uint32        { return p.u32(s + 2) }
+func (p *ppmdModel) setSuccessor(s uint32, v uint32)  { p.setU32(s+2, v) }
+func (p *ppmdModel) i2u(indx uint32) uint32           { return uint32(p.indx2Units[indx]) }
+func (p *ppmdModel) u2i(nu uint32) uint32             { return uint32(p.units2Indx[nu-1]) }
+func (p *ppmdModel) u2b(nu uint32) uint32             { return nu * ppmdUnitSize }
+func (p *ppmdModel) copyUnits(dst, src uint32, nu uint32) {
+	copy(p.mem[dst:dst+p.u2b(nu)], p.mem[src:])
+}
+
+func (p *ppmdModel) state(s uint32) ppmdState {
+	return ppmdState{p.mem[s], p.mem[s+1], p.u32(s + 2)}
+}
+
+func (p *ppmdModel) setState(s uint32, st ppmdState) {
+	p.mem[s] = st.symbol
+	p.mem[s+1] = st.freq
+	p.setU32(s+2, st.successor)
+}
+
+func (p *ppmdModel) swapStates(s1, s2 uint32) {
+	t1, t2 := p.state(s1), p.state(s2)
+	p.setState(s1, t2)
+	p.setState(s2, t1)
+}
+
+// memory allocator
+
+func (p *ppmdModel) insertNode(node, indx uint32) {
+	p.setU32(node, p.freeList[indx])
+	p.freeList[indx] = node
+}
+
+func (p *ppmdModel) removeNode(indx uint32) uint32 {
+	node := p.freeList[indx]
+	p.freeList[indx] = p.u32(node)
+	return node
+}
+
+func (p *ppmdModel) splitBlock(ptr, oldIndx, newIndx uint32) {
+	nu := p.i2u(oldIndx) - p.i2u(newIndx)
+	ptr += p.u2b(p.i2u(newIndx))
+
+	i := p.u2i(nu)
+	if p.i2u(i) != nu {
+		i--
+		k := p.i2u(i)
+		p.insertNode(ptr+p.u2b(k), nu-k-1)
+	}
+	p.insertNode(ptr, i)
+}
+
+func (p *ppmdModel) glueFreeBlocks() {
+	// nodes: stamp (uint16), nu (uint16), next (uint32), prev (uint32)
+	const (
+		stamp = 0
+		nuOff = 2
+		next  = 4
+		prev  = 8
+	)
+
+	head := p.alignOffset + p.size
+	n := head
+
+	p.glueCount = 255
+
+	// create a doubly-linked list of free blocks
+	for i := uint32(0); i < ppmdNumIndexes; i++ {
+		nu := p.i2u(i)
+		nextNode := p.freeList[i]
+		p.freeList[i] = 0
+		for nextNode != 0 {
+			node := nextNode
+			p.setU32(node+next, n)
+			p.setU32(n+prev, nextNode)
+			n = nextNode
+			nextNode = p.u32(node)
+			p.setU16(node+stamp, 0)
+			p.setU16(node+nuOff, nu)
+		}
+	}
+	p.setU16(head+stamp, 1)
+	p.setU32(head+next, n)
+	p.setU32(n+prev, head)
+	if p.loUnit != p.hiUnit {
+		p.setU16(p.loUnit+stamp, 1)
+	}
+
+	// glue adjacent free blocks
+	for n != head {
+		node := n
+		nu := p.u16(node + nuOff)
+		for {
+			node2 := node + nu*ppmdUnitSize
+			nu += p.u16(node2 + nuOff)
+			if p.u16(node2+stamp) != 0 || nu >= 0x10000 {
+				break
+			}
+			p.setU32(p.u32(node2+prev)+next, p.u32(node2+next))
+			p.setU32(p.u32(node2+next)+prev, p.u32(node2+prev))
+			p.setU16(node+nuOff, nu)
+		}
+		n = p.u32(node + next)
+	}
+
+	// fill the free block lists
+	for n = p.u32(head + next); n != head; {
+		node := n
+		nextNode := p.u32(node + next)
+		nu := p.u16(node + nuOff)
+		for ; nu > 128; nu, node = nu-128, node+128*ppmdUnitSize {
+			p.insertNode(node, ppmdNumIndexes-1)
+		}
+		i := p.u2i(nu)
+		if p.i2u(i) != nu {
+			i--
+			k := p.i2u(i)
+			p.insertNode(node+k*ppmdUnitSize, nu-k-1)
+		}
+		p.insertNode(node, i)
+		n = nextNode
+	}
+}
+
+func (p *ppmdModel) allocUnitsRare(indx uint32) uint32 {
+	if p.glueCount == 0 {
+		p.glueFreeBlocks()
+		if p.freeList[indx] != 0 {
+			return p.removeNode(indx)
+		}
+	}
+
+	i := indx
+	for {
+		i++
+		if i == ppmdNumIndexes {
+			numBytes := p.u2b(p.i2u(indx))
+			p.glueCount--
+			if p.unitsStart-p.text > numBytes {
+				p.unitsStart -= numBytes
+				return p.unitsStart
+			}
+			return 0
+		}
+		if p.freeList[i] != 0 {
+			break
+		}
+	}
+
+	retVal := p.removeNode(i)
+	p.splitBlock(retVal, i, indx)
+	return retVal
+}
+
+func (p *ppmdModel) allocUnits(indx uint32) uint32 {
+	if p.freeList[indx] != 0 {
+		return p.removeNode(indx)
+	}
+
+	numBytes := p.u2b(p.i2u(indx))
+	if numBytes <= p.hiUnit-p.loUnit {
+		retVal := p.loUnit
+		p.loUnit += numBytes
+		return retVal
+	}
+	return p.allocUnitsRare(indx)
+}
+
+func (p *ppmdModel) shrinkUnits(oldPtr, oldNU, newNU uint32) uint32 {
+	i0 := p.u2i(oldNU)
+	i1 := p.u2i(newNU)
+	if i0 == i1 {
+		return oldPtr
+	}
+	if p.freeList[i1] != 0 {
+		ptr := p.removeNode(i1)
+		p.copyUnits(ptr, oldPtr, newNU)
+		p.insertNode(oldPtr, i0)
+		return ptr
+	}
+	p.splitBlock(oldPtr, i0, i1)
+	return oldPtr
+}
+
+// model
+
+func (p *ppmdModel) restartModel() {
+	for i := range p.freeList {
+		p.freeList[i] = 0
+	}
+
+	p.text = p.alignOffset
+	p.hiUnit = p.text + p.size
+	p.loUnit = p.hiUnit - p.size/8/ppmdUnitSize*7*ppmdUnitSize
+	p.unitsStart = p.loUnit
+	p.glueCount = 0
+
+	p.orderFall = p.maxOrder
+	rl := p.maxOrder
+	if rl > 12 {
+		rl = 12
+	}
+	p.initRL = -int32(rl) - 1
+	p.runLength = p.initRL
+	p.prevSuccess = 0
+
+	p.hiUnit -= ppmdUnitSize
+	p.minContext = p.hiUnit
+	p.maxContext = p.hiUnit
+	p.setSuffix(p.minContext, 0)
+	p.setNumStats(p.minContext, 256)
+	p.setSummFreq(p.minContext, 256+1)
+
+	p.foundState = p.loUnit
+	p.setStats(p.minContext, p.loUnit)
+	for i := uint32(0); i < 256; i++ {
+		p.setState(p.loUnit+i*ppmdStateSize, ppmdState{symbol: byte(i), freq: 1})
+	}
+	p.loUnit += p.u2b(256 / 2)
+
+	for i := range p.binSumm {
+		for k := range ppmdInitBinEsc {
+			val := uint16(ppmdBinScale - uint32(ppmdInitBinEsc[k])/uint32(i+2))
+			for m := 0; m < 64; m += 8 {
+				p.binSumm[i][k+m] = val
+			}
+		}
+	}
+
+	for i := range p.see {
+		for k := range p.see[i] {
+			p.see[i][k] = ppmdSee{
+				summ:  uint16((5*i + 10) << (ppmdPeriodBits - 4)),
+				shift: ppmdPeriodBits - 4,
+				count: 4,
+			}
+		}
+	}
+}
+
+func (p *ppmdModel) createSuccessors(skip bool) uint32 {
+	c := p.minContext
+	upBranch := p.successor(p.foundState)
+	fsymbol := p.symbol(p.foundState)
+
+	var ps [PPMdMaxOrder]uint32
+	numPs := 0
+	if !skip {
+		ps[numPs] = p.foundState
+		numPs++
+	}
+
+	for p.suffix(c) != 0 {
+		c = p.suffix(c)
+
+		var s uint32
+		if p.numStats(c) != 1 {
+			for s = p.stats(c); p.symbol(s) != fsymbol; s += ppmdStateSize {
+			}
+		} else {
+			s = p.oneState(c)
+		}
+
+		successor := p.successor(s)
+		if successor != upBranch {
+			c = successor
+			if numPs == 0 {
+				return c
+			}
+			break
+		}
+		ps[numPs] = s
+		numPs++
+	}
+
+	upState := ppmdState{
+		symbol:    p.mem[upBranch],
+		successor: upBranch + 1,
+	}
+
+	if p.numStats(c) == 1 {
+		upState.freq = byte(p.freq(p.oneState(c)))
+	} else {
+		var s uint32
+		for s = p.stats(c); p.symbol(s) != uint32(upState.symbol); s += ppmdStateSize {
+		}
+		cf := p.freq(s) - 1
+		s0 := p.summFreq(c) - p.numStats(c) - cf
+
+		var freq uint32
+		if 2*cf <= s0 {
+			if 5*cf > s0 {
+				freq = 1
+			}
+		} else {
+			freq = (2*cf + 3*s0 - 1) / (2 * s0)
+		}
+		upState.freq = byte(1 + freq)
+	}
+
+	for numPs != 0 {
+		var c1 uint32
+		if p.hiUnit != p.loUnit {
+			p.hiUnit -= ppmdUnitSize
+			c1 = p.hiUnit
+		} else if p.freeList[0] != 0 {
+			c1 = p.removeNode(0)
+		} else {
+			c1 = p.allocUnitsRare(0)
+			if c1 == 0 {
+				return 0
+			}
+		}
+
+		p.setNumStats(c1, 1)
+		p.setState(p.oneState(c1), upState)
+		p.setSuffix(c1, c)
+		numPs--
+		p.setSuccessor(ps[numPs], c1)
+		c = c1
+	}
+
+	return c
+}
+
+func (p *ppmdModel) updateModel() {
+	fSuccessor := p.successor(p.foundState)
+	fSymbol := p.symbol(p.foundState)
+	fFreq := p.freq(p.foundState)
+
+	if fFreq < ppmdMaxFreq/4 && p.suffix(p.minContext) != 0 {
+		c := p.suffix(p.minContext)
+		if p.numStats(c) == 1 {
+			s := p.oneState(c)
+			if p.freq(s) < 32 {
+				p.setFreq(s, p.freq(s)+1)
+			}
+		} else {
+			s := p.stats(c)
+			if p.symbol(s) != fSymbol {
+				for {
+					s += ppmdStateSize
+					if p.symbol(s) == fSymbol {
+						break
+					}
+				}
+				if p.freq(s) >= p.freq(s-ppmdStateSize) {
+					p.swapStates(s, s-ppmdStateSize)
+					s -= ppmdStateSize
+				}
+			}
+			if p.freq(s) < ppmdMaxFreq-9 {
+				p.setFreq(s, p.freq(s)+2)
+				p.setSummFreq(c, p.summFreq(c)+2)
+			}
+		}
+	}
+
+	if p.orderFall == 0 {
+		p.minContext = p.createSuccessors(true)
+		p.maxContext = p.minContext
+		if p.minContext == 0 {
+			p.restartModel()
+			return
+		}
+		p.setSuccessor(p.foundState, p.minContext)
+		return
+	}
+
+	p.mem[p.text] = byte(fSymbol)
+	p.text++
+	successor := p.text
+	if p.text >= p.unitsStart {
+		p.restartModel()
+		return
+	}
+
+	if fSuccessor != 0 {
+		if fSuccessor <= successor {
+			cs := p.createSuccessors(false)
+			if cs == 0 {
+				p.restartModel()
+				return
+			}
+			fSuccessor = cs
+		}
+		p.orderFall--
+		if p.orderFall == 0 {
+			successor = fSuccessor
+			if p.maxContext != p.minContext {
+				p.text--
+			}
+		}
+	} else {
+		p.setSuccessor(p.foundState, successor)
+		fSuccessor = p.minContext
+	}
+
+	ns := p.numStats(p.minContext)
+	s0 := p.summFreq(p.minContext) - ns - (fFreq - 1)
+
+	for c := p.maxContext; c != p.minContext; c = p.suffix(c) {
+		ns1 := p.numStats(c)
+		if ns1 != 1 {
+			if ns1&1 == 0 {
+				// expand for one unit
+				oldNU := ns1 >> 1
+				i := p.u2i(oldNU)
+				if i != p.u2i(oldNU+1) {
+					ptr := p.allocUnits(i + 1)
+					if ptr == 0 {
+						p.restartModel()
+						return
+					}
+					oldPtr := p.stats(c)
+					p.copyUnits(ptr, oldPtr, oldNU)
+					p.insertNode(oldPtr, i)
+					p.setStats(c, ptr)
+				}
+			}
+
+			summFreq := p.summFreq(c)
+			if 2*ns1 < ns {
+				summFreq++
+			}
+			if 4*ns1 <= ns && p.summFreq(c) <= 8*ns1 {
+				summFreq += 2
+			}
+			p.setSummFreq(c, summFreq)
+		} else {
+			s := p.allocUnits(0)
+			if s == 0 {
+				p.restartModel()
+				return
+			}
+			p.setState(s, p.state(p.oneState(c)))
+			p.setStats(c, s)
+
+			freq := p.freq(s)
+			if freq < ppmdMaxFreq/4-1 {
+				freq <<= 1
+			} else {
+				freq = ppmdMaxFreq - 4
+			}
+			p.setFreq(s, freq)
+
+			summFreq := p.freq(s) + p.initEsc
+			if ns > 3 {
+				summFreq++
+			}
+			p.setSummFreq(c, summFreq)
+		}
+
+		cf := 2 * fFreq * (p.summFreq(c) + 6)
+		sf := s0 + p.summFreq(c)
+		if cf < 6*sf {
+			n := uint32(1)
+			if cf > sf {
+				n++
+			}
+			if cf >= 4*sf {
+				n++
+			}
+			cf = n
+			p.setSummFreq(c, p.summFreq(c)+3)
+		} else {
+			n := uint32(4)
+			if cf >= 9*sf {
+				n++
+			}
+			if cf >= 12*sf {
+				n++
+			}
+			if cf >= 15*sf {
+				n++
+			}
+			cf = n
+			p.setSummFreq(c, p.summFreq(c)+cf)
+		}
+
+		s := p.stats(c) + ns1*ppmdStateSize
+		p.setState(s, ppmdState{symbol: byte(fSymbol), freq: byte(cf), successor: successor})
+		p.setNumStats(c, ns1+1)
+	}
+
+	p.maxContext = fSuccessor
+	p.minContext = fSuccessor
+}
+
+func (p *ppmdModel) rescale() {
+	stats := p.stats(p.minContext)
+	s := p.foundState
+
+	// move the found state to the front
+	tmp := p.state(s)
+	for ; s != stats; s -= ppmdStateSize {
+		p.setState(s, p.state(s-ppmdStateSize))
+	}
+	p.setState(s, tmp)
+
+	escFreq := p.summFreq(p.minContext) - p.freq(s)
+	adder := uint32(0)
+	if p.orderFall != 0 {
+		adder = 1
+	}
+	p.setFreq(s, (uint32(byte(p.freq(s)+4))+adder)>>1)
+	sumFreq := p.freq(s)
+
+	i := p.numStats(p.minContext) - 1
+	for ; i > 0; i-- {
+		s += ppmdStateSize
+		escFreq -= p.freq(s)
+		p.setFreq(s, (p.freq(s)+adder)>>1)
+		sumFreq += p.freq(s)
+		if p.freq(s) > p.freq(s-ppmdStateSize) {
+			s1 := s
+			tmp := p.state(s1)
+			for {
+				p.setState(s1, p.state(s1-ppmdStateSize))
+				s1 -= ppmdStateSize
+				if s1 == stats || uint32(tmp.freq) <= p.freq(s1-ppmdStateSize) {
+					break
+				}
+			}
+			p.setState(s1, tmp)
+		}
+	}
+
+	if p.freq(s) == 0 {
+		numStats := p.numStats(p.minContext)
+		i = 0
+		for {
+			i++
+			s -= ppmdStateSize
+			if p.freq(s) != 0 {
+				break
+			}
+		}
+		escFreq += i
+		p.setNumStats(p.minContext, numStats-i)
+
+		if p.numStats(p.minContext) == 1 {
+			tmp := p.state(stats)
+			for {
+				tmp.freq -= tmp.freq >> 1
+				escFreq >>= 1
+				if escFreq <= 1 {
+					break
+				}
+			}
+			p.insertNode(stats, p.u2i((numStats+1)>>1))
+			p.foundState = p.oneState(p.minContext)
+			p.setState(p.foundState, tmp)
+			return
+		}
+
+		n0 := (numStats + 1) >> 1
+		n1 := (p.numStats(p.minContext) + 1) >> 1
+		if n0 != n1 {
+			p.setStats(p.minContext, p.shrinkUnits(stats, n0, n1))
+		}
+	}
+
+	p.setSummFreq(p.minContext, sumFreq+escFreq-(escFreq>>1))
+	p.foundState = p.stats(p.minContext)
+}
+
+func (p *ppmdModel) makeEscFreq(numMasked uint32) (*ppmdSee, uint32) {
+	numStats := p.numStats(p.minContext)
+	if numStats == 256 {
+		return &p.dummySee, 1
+	}
+
+	nonMasked := numStats - numMasked
+
+	idx := p.hiBitsFlag
+	if nonMasked < p.numStats(p.suffix(p.minContext))-numStats {
+		idx++
+	}
+	if p.summFreq(p.minContext) < 11*numStats {
+		idx += 2
+	}
+	if numMasked > nonMasked {
+		idx += 4
+	}
+
+	see := &p.see[p.ns2Indx[nonMasked-1]][idx]
+	r := uint32(see.summ >> see.shift)
+	see.summ -= uint16(r)
+	if r == 0 {
+		r = 1
+	}
+
+	return see, r
+}
+
+func (p *ppmdModel) nextContext() {
+	c := p.successor(p.foundState)
+	if p.orderFall == 0 && c > p.text {
+		p.minContext = c
+		p.maxContext = c
+	} else {
+		p.updateModel()
+	}
+}
+
+func (p *ppmdModel) update1() {
+	s := p.foundState
+	p.setFreq(s, p.freq(s)+4)
+	p.setSummFreq(p.minContext, p.summFreq(p.minContext)+4)
+	if p.freq(s) > p.freq(s-ppmdStateSize) {
+		p.swapStates(s, s-ppmdStateSize)
+		s -= ppmdStateSize
+		p.foundState = s
+		if p.freq(s) > ppmdMaxFreq {
+			p.rescale()
+		}
+	}
+	p.nextContext()
+}
+
+func (p *ppmdModel) update1_0() {
+	p.prevSuccess = 0
+	if 2*p.freq(p.foundState) > p.summFreq(p.minContext) {
+		p.prevSuccess = 1
+	}
+	p.runLength += int32(p.prevSuccess)
+	p.setSummFreq(p.minContext, p.summFreq(p.minContext)+4)
+	p.setFreq(p.foundState, p.freq(p.foundState)+4)
+	if p.freq(p.foundState) > ppmdMaxFreq {
+		p.rescale()
+	}
+	p.nextContext()
+}
+
+func (p *ppmdModel) updateBin() {
+	if p.freq(p.foundState) < 128 {
+		p.setFreq(p.foundState, p.freq(p.foundState)+1)
+	}
+	p.prevSuccess = 1
+	p.runLength++
+	p.nextContext()
+}
+
+func (p *ppmdModel) update2() {
+	s := p.foundState
+	p.setFreq(s, p.freq(s)+4)
+	p.setSummFreq(p.minContext, p.summFreq(p.minContext)+4)
+	if p.freq(s) > ppmdMaxFreq {
+		p.rescale()
+	}
+	p.runLength = p.initRL
+	p.updateModel()
+}
+
+func (p *ppmdModel) binSummFor() *uint16 {
+	s := p.oneState(p.minContext)
+	p.hiBitsFlag = uint32(p.hb2Flag[p.symbol(p.foundState)])
+
+	i := p.freq(s) - 1
+	k := p.prevSuccess +
+		uint32(p.ns2BSIndx[p.numStats(p.suffix(p.minContext))-1]) +
+		p.hiBitsFlag +
+		2*uint32(p.hb2Flag[p.symbol(s)]) +
+		uint32(p.runLength>>26)&0x20
+
+	return &p.binSumm[i][k]
+}
+
+type ppmdRangeDecoder struct {
+	r    io.ByteReader
+	rng  uint32
+	code uint32
+	err  error
+}
+
+func (rc *ppmdRangeDecoder) init() error {
+	rc.code = 0
+	rc.rng = 0xFFFFFFFF
+	if rc.readByte() != 0 {
+		return ErrPPMdDataError
+	}
+	for i := 0; i < 4; i++ {
+		rc.code = rc.code<<8 | uint32(rc.readByte())
+	}
+	if rc.err != nil {
+		return rc.err
+	}
+	if rc.code == 0xFFFFFFFF {
+		return ErrPPMdDataError
+	}
+	return nil
+}
+
+func (rc *ppmdRangeDecoder) readByte() byte {
+	b, err := rc.r.ReadByte()
+	if err != nil && rc.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		rc.err = err
+	}
+	return b
+}
+
+func (rc *ppmdRangeDecoder) threshold(total uint32) uint32 {
+	rc.rng /= total
+	return rc.code / rc.rng
+}
+
+func (rc *ppmdRangeDecoder) normalize() {
+	if rc.rng < ppmdTopValue {
+		rc.code = rc.code<<8 | uint32(rc.readByte())
+		rc.rng <<= 8
+		if rc.rng < ppmdTopValue {
+			rc.code = rc.code<<8 | uint32(rc.readByte())
+			rc.rng <<= 8
+		}
+	}
+}
+
+func (rc *ppmdRangeDecoder) decode(start, size uint32) {
+	rc.code -= start * rc.rng
+	rc.rng *= size
+	rc.normalize()
+}
+
+func (rc *ppmdRangeDecoder) decodeBit(size0, total uint32) uint32 {
+	newBound := (rc.rng / total) * size0
+	var symbol uint32
+	if rc.code < newBound {
+		rc.rng = newBound
+	} else {
+		symbol = 1
+		rc.code -= newBound
+		rc.rng -= newBound
+	}
+	rc.normalize()
+	return symbol
+}
+
+// decodeSymbol decodes a single symbol. -1 is returned for an end marker and
+// -2 for a data error.
+func (p *ppmdModel) decodeSymbol(rc *ppmdRangeDecoder) int {
+	var charMask [256]byte
+
+	if p.numStats(p.minContext) != 1 {
+		s := p.stats(p.minContext)
+		count := rc.threshold(p.summFreq(p.minContext))
+		hiCnt := p.freq(s)
+		if count < hiCnt {
+			rc.decode(0, p.freq(s))
+			p.foundState = s
+			symbol := p.symbol(s)
+			p.update1_0()
+			return int(symbol)
+		}
+
+		p.prevSuccess = 0
+		for i := p.numStats(p.minContext) - 1; i > 0; i-- {
+			s += ppmdStateSize
+			hiCnt += p.freq(s)
+			if hiCnt > count {
+				rc.decode(hiCnt-p.freq(s), p.freq(s))
+				p.foundState = s
+				symbol := p.symbol(s)
+				p.update1()
+				return int(symbol)
+			}
+		}
+
+		if count >= p.summFreq(p.minContext) {
+			return -2
+		}
+		p.hiBitsFlag = uint32(p.hb2Flag[p.symbol(p.foundState)])
+		rc.decode(hiCnt, p.summFreq(p.minContext)-hiCnt)
+
+		for i := range charMask {
+			charMask[i] = 0xFF
+		}
+		charMask[p.symbol(s)] = 0
+		for i := p.numStats(p.minContext) - 1; i > 0; i-- {
+			s -= ppmdStateSize
+			charMask[p.symbol(s)] = 0
+		}
+	} else {
+		prob := p.binSummFor()
+		if rc.decodeBit(uint32(*prob), ppmdBinScale) == 0 {
+			*prob = *prob + 1<<ppmdIntBits - ppmdGetMean(*prob)
+			p.foundState = p.oneState(p.minContext)
+			symbol := p.symbol(p.foundState)
+			p.updateBin()
+			return int(symbol)
+		}
+
+		*prob = *prob - ppmdGetMean(*prob)
+		p.initEsc = uint32(ppmdExpEscape[*prob>>10])
+
+		for i := range charMask {
+			charMask[i] = 0xFF
+		}
+		charMask[p.symbol(p.oneState(p.minContext))] = 0
+		p.prevSuccess = 0
+	}
+
+	var ps [256]uint32
+	for {
+		numMasked := p.numStats(p.minContext)
+		for {
+			p.orderFall++
+			if p.suffix(p.minContext) == 0 {
+				return -1
+			}
+			p.minContext = p.suffix(p.minContext)
+			if p.numStats(p.minContext) != numMasked {
+				break
+			}
+		}
+
+		hiCnt := uint32(0)
+		s := p.stats(p.minContext)
+		num := p.numStats(p.minContext) - numMasked
+		i := uint32(0)
+		for i != num {
+			if charMask[p.symbol(s)] != 0 {
+				hiCnt += p.freq(s)
+				ps[i] = s
+				i++
+			}
+			s += ppmdStateSize
+		}
+
+		see, freqSum := p.makeEscFreq(numMasked)
+		freqSum += hiCnt
+		count := rc.threshold(freqSum)
+
+		if count < hiCnt {
+			k := 0
+			hiCnt = 0
+			for {
+				hiCnt += p.freq(ps[k])
+				if hiCnt > count {
+					break
+				}
+				k++
+			}
+			s = ps[k]
+			rc.decode(hiCnt-p.freq(s), p.freq(s))
+			see.update()
+			p.foundState = s
+			symbol := p.symbol(s)
+			p.update2()
+			return int(symbol)
+		}
+
+		if count >= freqSum {
+			return -2
+		}
+		rc.decode(hiCnt, freqSum-hiCnt)
+		see.summ += uint16(freqSum)
+		for i > 0 {
+			i--
+			charMask[p.symbol(ps[i])] = 0
+		}
+	}
+}
+
+func ppmdGetMean(prob uint16) uint16 {
+	return (prob + 1<<(ppmdPeriodBits-2)) >> ppmdPeriodBits
+}
+
+// PPMdDecoder is a PPMd variant H decoder, as used by 7z.
+type PPMdDecoder struct {
+	model *ppmdModel
+	rc    ppmdRangeDecoder
+
+	remaining int64
+	err       error
+}
+
+// NewPPMdDecoder returns a new PPMd variant H decoder. order and memSize are
+// the model order and memory size used during compression, and limit is the
+// size of the decompressed data.
+func NewPPMdDecoder(r io.Reader, order int, memSize uint32, limit int64) (*PPMdDecoder, error) {
+	if order < PPMdMinOrder || order > PPMdMaxOrder || memSize < PPMdMinMemSize || memSize > PPMdMaxMemSize {
+		return nil, ErrPPMdInvalidProperties
+	}
+
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	d := &PPMdDecoder{
+		rc:        ppmdRangeDecoder{r: br},
+		remaining: limit,
+	}
+	if err := d.rc.init(); err != nil {
+		return nil, err
+	}
+	d.model = newPPMdModel(order, memSize)
+
+	return d, nil
+}
+
+func (d *PPMdDecoder) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+
+	var n int
+	for n < len(p) && d.remaining > 0 {
+		sym := d.model.decodeSymbol(&d.rc)
+		if d.rc.err != nil {
+			d.err = d.rc.err
+			return n, d.err
+		}
+		if sym < 0 {
+			// an end marker before the expected size is reached, or a
+			// corrupt stream
+			d.err = ErrPPMdDataError
+			if sym == -1 {
+				d.err = io.ErrUnexpectedEOF
+			}
+			return n, d.err
+		}
+
+		p[n] = byte(sym)
+		n++
+		d.remaining--
+	}
+
+	if d.remaining == 0 {
+		d.err = io.EOF
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return n, d.err
+}
@@ -0,0 +1,69 @@
+package filters
+
+import "io"
+
+const swapBufferSize = 32 * 1024
+
+// SwapDecoder is a Swap2 or Swap4 decoder, reversing the byte order of each
+// 2 or 4 byte word. Trailing bytes that don't fill a word are left as is.
+type SwapDecoder struct {
+	r     io.Reader
+	width int
+	err   error
+
+	buf     [swapBufferSize]byte
+	pos     int // position of the unread output in buf
+	swapped int // end of the output, followed by an incomplete word
+	end     int
+}
+
+// NewSwap2Decoder returns a new Swap2 decoder.
+func NewSwap2Decoder(r io.Reader) (*SwapDecoder, error) {
+	return &SwapDecoder{r: r, width: 2}, nil
+}
+
+// NewSwap4Decoder returns a new Swap4 decoder.
+func NewSwap4Decoder(r io.Reader) (*SwapDecoder, error) {
+	return &SwapDecoder{r: r, width: 4}, nil
+}
+
+func (d *SwapDecoder) Read(p []byte) (int, error) {
+	for d.pos == d.swapped {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.fill()
+	}
+
+	n := copy(p, d.buf[d.pos:d.swapped])
+	d.pos += n
+	return n, nil
+}
+
+// fill reads more input, swapping each complete word.
+func (d *SwapDecoder) fill() {
+	// keep the incomplete word for the next read
+	n := copy(d.buf[:], d.buf[d.swapped:d.end])
+
+	m, err := d.r.Read(d.buf[n:])
+	d.pos, d.end = 0, n+m
+	d.swapped = d.end - d.end%d.width
+
+	buf := d.buf[:d.swapped]
+	if d.width == 2 {
+		for i := 0; i < len(buf); i += 2 {
+			buf[i], buf[i+1] = buf[i+1], buf[i]
+		}
+	} else {
+		for i := 0; i < len(buf); i += 4 {
+			buf[i], buf[i+1], buf[i+2], buf[i+3] = buf[i+3], buf[i+2], buf[i+1], buf[i]
+		}
+	}
+
+	if err != nil {
+		if err == io.EOF {
+			d.swapped = d.end
+		}
+		d.err = err
+	}
+}
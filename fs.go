@@ -0,0 +1,274 @@
+package go7z
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	_ fs.ReadDirFS  = (*Reader)(nil)
+	_ fs.StatFS     = (*Reader)(nil)
+	_ fs.ReadFileFS = (*Reader)(nil)
+)
+
+// fsEntry is a file or directory in the archive's file system. Directories
+// that are only implied by the paths of other files have no File.
+type fsEntry struct {
+	name     string
+	file     *File
+	isDir    bool
+	children []*fsEntry
+}
+
+func (e *fsEntry) Name() string {
+	return path.Base(e.name)
+}
+
+func (e *fsEntry) Size() int64 {
+	if e.file == nil || e.isDir {
+		return 0
+	}
+	return int64(e.file.Size())
+}
+
+func (e *fsEntry) Mode() fs.FileMode {
+	if e.file == nil {
+		return fs.ModeDir | 0755
+	}
+
+	mode := e.file.Mode()
+	if e.isDir && !mode.IsDir() {
+		// a file whose name is also the parent of other files
+		mode = fs.ModeDir | mode.Perm()
+	}
+	return mode
+}
+
+func (e *fsEntry) Type() fs.FileMode {
+	return e.Mode().Type()
+}
+
+func (e *fsEntry) ModTime() time.Time {
+	if e.file == nil {
+		return time.Time{}
+	}
+	return e.file.ModifiedAt
+}
+
+func (e *fsEntry) IsDir() bool {
+	return e.isDir
+}
+
+func (e *fsEntry) Sys() interface{} {
+	if e.file == nil {
+		return nil
+	}
+	return e.file.FileInfo
+}
+
+func (e *fsEntry) Info() (fs.FileInfo, error) {
+	return e, nil
+}
+
+// toValidName coerces an archive path to a name that is valid for fs.FS.
+func toValidName(name string) string {
+	name = strings.Replace(name, `\`, "/", -1)
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (sz *Reader) initFS() {
+	sz.fsOnce.Do(func() {
+		root := &fsEntry{name: ".", isDir: true}
+		sz.fsEntries = map[string]*fsEntry{".": root}
+
+		var dir func(name string) *fsEntry
+		dir = func(name string) *fsEntry {
+			e, ok := sz.fsEntries[name]
+			if !ok {
+				e = &fsEntry{name: name}
+				sz.fsEntries[name] = e
+
+				parent := dir(path.Dir(name))
+				parent.children = append(parent.children, e)
+			}
+			e.isDir = true
+			return e
+		}
+
+		for _, file := range sz.File {
+			name := toValidName(file.Name)
+			if name == "." {
+				continue
+			}
+
+			var e *fsEntry
+			if file.IsDir() {
+				e = dir(name)
+			} else {
+				// later entries with the same name replace earlier ones
+				e = sz.fsEntries[name]
+				if e == nil {
+					e = &fsEntry{name: name}
+					sz.fsEntries[name] = e
+
+					parent := dir(path.Dir(name))
+					parent.children = append(parent.children, e)
+				}
+			}
+			e.file = file
+		}
+
+		for _, e := range sz.fsEntries {
+			sort.Slice(e.children, func(i, j int) bool {
+				return e.children[i].name < e.children[j].name
+			})
+		}
+	})
+}
+
+func (sz *Reader) lookup(op, name string) (*fsEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	sz.initFS()
+	e, ok := sz.fsEntries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+// Open opens the named file in the archive, using the semantics of fs.FS.Open:
+// paths are always slash separated, with no leading / or ../ elements.
+//
+// Directories that are only implied by the paths of other files in the
+// archive are synthesized. Opening a file doesn't affect the position of Next,
+// and only decompresses the folder holding the file.
+func (sz *Reader) Open(name string) (fs.File, error) {
+	e, err := sz.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.isDir {
+		return &fsDir{e: e}, nil
+	}
+
+	rc, err := e.file.Open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{e: e, rc: rc}, nil
+}
+
+// ReadDir reads the named directory and returns a list of directory entries
+// sorted by filename.
+func (sz *Reader) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := sz.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	entries := make([]fs.DirEntry, len(e.children))
+	for i, child := range e.children {
+		entries[i] = child
+	}
+	return entries, nil
+}
+
+// Stat returns a fs.FileInfo describing the named file.
+func (sz *Reader) Stat(name string) (fs.FileInfo, error) {
+	e, err := sz.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ReadFile reads and returns the contents of the named file.
+func (sz *Reader) ReadFile(name string) ([]byte, error) {
+	f, err := sz.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, ok := f.(*fsDir); ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+type fsFile struct {
+	e  *fsEntry
+	rc io.ReadCloser
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.e, nil
+}
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	return f.rc.Read(p)
+}
+
+func (f *fsFile) Close() error {
+	return f.rc.Close()
+}
+
+type fsDir struct {
+	e      *fsEntry
+	offset int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.e, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.e.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	n := len(d.e.children) - d.offset
+	if count > 0 && n > count {
+		n = count
+	}
+	if n == 0 {
+		if count > 0 {
+			return nil, io.EOF
+		}
+		return []fs.DirEntry{}, nil
+	}
+
+	entries := make([]fs.DirEntry, n)
+	for i := range entries {
+		entries[i] = d.e.children[d.offset+i]
+	}
+	d.offset += n
+
+	return entries, nil
+}
@@ -0,0 +1,46 @@
+package go7z
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	entries := append([]testEntry{
+		{Name: "implicit/parent/file.txt", Contents: []byte("implicit parents")},
+	}, testEntries...)
+
+	sz := openTestArchive(t, entries, nil)
+
+	var expected []string
+	for _, entry := range entries {
+		expected = append(expected, entry.Name)
+	}
+	if err := fstest.TestFS(sz, expected...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if entry.Dir {
+			continue
+		}
+
+		contents, err := fs.ReadFile(sz, entry.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, entry.Contents) {
+			t.Fatalf("%v: contents mismatch", entry.Name)
+		}
+	}
+
+	info, err := fs.Stat(sz, "implicit/parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() {
+		t.Fatalf("expected implicit/parent to be a directory")
+	}
+}
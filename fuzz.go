@@ -4,6 +4,7 @@ package go7z
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"io/ioutil"
 )
@@ -14,19 +15,27 @@ func Fuzz(data []byte) int {
 		return 0
 	}
 
+	ok := true
 	for {
 		_, err := sz.Next()
 		if err == io.EOF {
-			return 0
+			break
 		}
 		if err != nil {
-			return 0
+			ok = false
+			break
 		}
 
 		if _, err = io.Copy(ioutil.Discard, sz); err != nil {
-			return 0
+			ok = false
+			break
 		}
 	}
 
+	// Test decodes each folder again, separately from Next and Read
+	report, err := sz.Test(context.Background())
+	if err != nil || !report.OK() || !ok {
+		return 0
+	}
 	return 1
 }
@@ -23,3 +23,26 @@ func ReadDigests(r io.Reader, length int) ([]uint32, error) {
 
 	return crcs, nil
 }
+
+// WriteDigests writes an array of uint32 CRCs. Zero CRCs are marked as
+// undefined.
+func WriteDigests(w io.Writer, crcs []uint32) error {
+	defined := make([]bool, len(crcs))
+	for i := range crcs {
+		defined[i] = crcs[i] != 0
+	}
+
+	if err := WriteOptionalBoolVector(w, defined); err != nil {
+		return err
+	}
+
+	for i := range crcs {
+		if defined[i] {
+			if err := binary.Write(w, binary.LittleEndian, crcs[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
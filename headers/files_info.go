@@ -1,21 +1,40 @@
 package headers
 
 import (
-	"encoding/binary"
+	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"os"
 	"time"
-	"unicode/utf16"
 )
 
 // ErrInvalidFileCount is returned when the file count read from the stream
 // exceeds the caller supplied maxFileCount.
 var ErrInvalidFileCount = errors.New("invalid file count")
 
+// FileCountError is returned when the file count read from the stream exceeds
+// the caller supplied maxFileCount. It is checked before any FileInfo is
+// allocated.
+type FileCountError struct {
+	Count int
+	Max   int
+}
+
+func (e *FileCountError) Error() string {
+	return fmt.Sprintf("%v: %d exceeds %d", ErrInvalidFileCount, e.Count, e.Max)
+}
+
+// Unwrap returns ErrInvalidFileCount.
+func (e *FileCountError) Unwrap() error {
+	return ErrInvalidFileCount
+}
+
 // FileInfo is a structure containing the information of an archived file.
 type FileInfo struct {
-	Name   string
-	Attrib uint32
+	Name    string
+	Comment string
+	Attrib  uint32
 
 	IsEmptyStream bool
 	IsEmptyFile   bool
@@ -28,6 +47,120 @@ type FileInfo struct {
 	ModifiedAt time.Time
 }
 
+// Windows file attributes, held in the low 16 bits of FileInfo.Attrib.
+const (
+	FileAttributeReadonly     = 0x1
+	FileAttributeHidden       = 0x2
+	FileAttributeSystem       = 0x4
+	FileAttributeDirectory    = 0x10
+	FileAttributeArchive      = 0x20
+	FileAttributeReparsePoint = 0x400
+
+	// FileAttributeUnixExtension is set by p7zip and others when the high 16
+	// bits of FileInfo.Attrib hold the Unix file mode.
+	FileAttributeUnixExtension = 0x8000
+)
+
+// Unix file type bits, as found in the Unix file mode.
+const (
+	unixTypeMask    = 0170000
+	unixTypeFIFO    = 0010000
+	unixTypeChar    = 0020000
+	unixTypeDir     = 0040000
+	unixTypeBlock   = 0060000
+	unixTypeSymlink = 0120000
+	unixTypeSocket  = 0140000
+
+	unixSetuid = 04000
+	unixSetgid = 02000
+	unixSticky = 01000
+)
+
+// Mode returns the file's mode and permission bits. The Unix file mode is
+// used when present, otherwise the mode is derived from the Windows
+// attributes, with files being 0644 and directories 0755.
+func (fi *FileInfo) Mode() os.FileMode {
+	if fi.Attrib&FileAttributeUnixExtension != 0 {
+		unixMode := fi.Attrib >> 16
+
+		mode := os.FileMode(unixMode & 0777)
+		if unixMode&unixSetuid != 0 {
+			mode |= os.ModeSetuid
+		}
+		if unixMode&unixSetgid != 0 {
+			mode |= os.ModeSetgid
+		}
+		if unixMode&unixSticky != 0 {
+			mode |= os.ModeSticky
+		}
+
+		switch unixMode & unixTypeMask {
+		case unixTypeFIFO:
+			mode |= os.ModeNamedPipe
+		case unixTypeChar:
+			mode |= os.ModeDevice | os.ModeCharDevice
+		case unixTypeDir:
+			mode |= os.ModeDir
+		case unixTypeBlock:
+			mode |= os.ModeDevice
+		case unixTypeSymlink:
+			mode |= os.ModeSymlink
+		case unixTypeSocket:
+			mode |= os.ModeSocket
+		}
+
+		// the directory attribute, or lack of contents, take precedence
+		if mode&os.ModeType == 0 && fi.IsDir() {
+			mode |= os.ModeDir
+		}
+		return mode
+	}
+
+	var mode os.FileMode = 0644
+	if fi.IsDir() {
+		mode = os.ModeDir | 0755
+	}
+	if fi.IsReadonly() {
+		mode &^= 0222
+	}
+	return mode
+}
+
+// IsDir returns whether the file is a directory.
+func (fi *FileInfo) IsDir() bool {
+	if fi.IsEmptyStream && !fi.IsEmptyFile || fi.Attrib&FileAttributeDirectory != 0 {
+		return true
+	}
+	return fi.Attrib&FileAttributeUnixExtension != 0 && (fi.Attrib>>16)&unixTypeMask == unixTypeDir
+}
+
+// IsSymlink returns whether the file is a symbolic link. The contents of a
+// symbolic link are the link's target.
+func (fi *FileInfo) IsSymlink() bool {
+	return fi.Attrib&FileAttributeUnixExtension != 0 && (fi.Attrib>>16)&unixTypeMask == unixTypeSymlink
+}
+
+// IsReadonly returns whether the file has the Windows readonly attribute.
+func (fi *FileInfo) IsReadonly() bool {
+	return fi.Attrib&FileAttributeReadonly != 0
+}
+
+// IsHidden returns whether the file has the Windows hidden attribute.
+func (fi *FileInfo) IsHidden() bool {
+	return fi.Attrib&FileAttributeHidden != 0
+}
+
+// IsSystem returns whether the file has the Windows system attribute.
+func (fi *FileInfo) IsSystem() bool {
+	return fi.Attrib&FileAttributeSystem != 0
+}
+
+// IsReparsePoint returns whether the file has the Windows reparse point
+// attribute, used for Windows symbolic links and junctions.
+func (fi *FileInfo) IsReparsePoint() bool {
+	return fi.Attrib&FileAttributeReparsePoint != 0
+}
+
 // ReadFilesInfo reads the files info structure.
 func ReadFilesInfo(r io.Reader, maxFileCount int) ([]*FileInfo, error) {
 	numFiles, err := ReadNumberInt(r)
@@ -35,7 +168,7 @@ func ReadFilesInfo(r io.Reader, maxFileCount int) ([]*FileInfo, error) {
 		return nil, err
 	}
 	if numFiles > maxFileCount {
-		return nil, ErrInvalidFileCount
+		return nil, &FileCountError{Count: numFiles, Max: maxFileCount}
 	}
 
 	fileInfo := make([]*FileInfo, numFiles)
@@ -90,7 +223,7 @@ func ReadFilesInfo(r io.Reader, maxFileCount int) ([]*FileInfo, error) {
 			}
 
 		case k7zStartPos:
-			return nil, ErrUnexpectedPropertyID
+			return nil, &UnexpectedPropertyIDError{PropertyID: id}
 
 		case k7zCTime, k7zATime, k7zMTime:
 			times, err := ReadDateTimeVector(r, numFiles)
@@ -108,32 +241,18 @@ func ReadFilesInfo(r io.Reader, maxFileCount int) ([]*FileInfo, error) {
 				}
 			}
 
-		case k7zName:
-			external, err := ReadByte(r)
+		case k7zName, k7zComment:
+			strs, err := ReadStringVector(r, numFiles)
 			if err != nil {
 				return nil, err
 			}
-
-			switch external {
-			case 0:
-				for _, fi := range fileInfo {
-					var rune uint16
-					var name []uint16
-					for {
-						if err = binary.Read(r, binary.LittleEndian, &rune); err != nil {
-							return nil, err
-						}
-
-						if rune == 0 {
-							break
-						}
-						name = append(name, rune)
-					}
-					fi.Name = string(utf16.Decode(name))
+			for i, fi := range fileInfo {
+				switch id {
+				case k7zName:
+					fi.Name = strs[i]
+				case k7zComment:
+					fi.Comment = strs[i]
 				}
-
-			default:
-				return nil, ErrAdditionalStreamsNotImplemented
 			}
 
 		case k7zWinAttributes:
@@ -153,7 +272,140 @@ func ReadFilesInfo(r io.Reader, maxFileCount int) ([]*FileInfo, error) {
 			}
 
 		default:
-			return nil, ErrUnexpectedPropertyID
+			return nil, &UnexpectedPropertyIDError{PropertyID: id}
+		}
+	}
+}
+
+// WriteFilesInfo writes the files info structure.
+func WriteFilesInfo(w io.Writer, fileInfo []*FileInfo) error {
+	if err := WriteNumber(w, uint64(len(fileInfo))); err != nil {
+		return err
+	}
+
+	var emptyStreams, emptyFiles, antiFiles []bool
+	var hasEmptyFiles, hasAntiFiles bool
+	var ctimes, atimes, mtimes []time.Time
+	var hasCTimes, hasATimes, hasMTimes bool
+	var names, comments []string
+	var hasComments bool
+	var attributes []uint32
+	var hasAttributes bool
+
+	for _, fi := range fileInfo {
+		names = append(names, fi.Name)
+		comments = append(comments, fi.Comment)
+		hasComments = hasComments || fi.Comment != ""
+
+		emptyStreams = append(emptyStreams, fi.IsEmptyStream)
+		if fi.IsEmptyStream {
+			emptyFiles = append(emptyFiles, fi.IsEmptyFile)
+			antiFiles = append(antiFiles, fi.IsAntiFile)
+			hasEmptyFiles = hasEmptyFiles || fi.IsEmptyFile
+			hasAntiFiles = hasAntiFiles || fi.IsAntiFile
 		}
+
+		ctimes = append(ctimes, fi.CreatedAt)
+		atimes = append(atimes, fi.AccessedAt)
+		mtimes = append(mtimes, fi.ModifiedAt)
+		hasCTimes = hasCTimes || !fi.CreatedAt.IsZero()
+		hasATimes = hasATimes || !fi.AccessedAt.IsZero()
+		hasMTimes = hasMTimes || !fi.ModifiedAt.IsZero()
+
+		attributes = append(attributes, fi.Attrib)
+		hasAttributes = hasAttributes || fi.Attrib != 0
 	}
+
+	buf := new(bytes.Buffer)
+	property := func(id byte, fn func(w io.Writer) error) error {
+		buf.Reset()
+		if err := fn(buf); err != nil {
+			return err
+		}
+		if err := WriteByte(w, id); err != nil {
+			return err
+		}
+		if err := WriteNumber(w, uint64(buf.Len())); err != nil {
+			return err
+		}
+		_, err := buf.WriteTo(w)
+		return err
+	}
+
+	if len(emptyFiles) > 0 {
+		err := property(k7zEmptyStream, func(w io.Writer) error {
+			return WriteBoolVector(w, emptyStreams)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasEmptyFiles {
+		err := property(k7zEmptyFile, func(w io.Writer) error {
+			return WriteBoolVector(w, emptyFiles)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasAntiFiles {
+		err := property(k7zAnti, func(w io.Writer) error {
+			return WriteBoolVector(w, antiFiles)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(fileInfo) > 0 {
+		err := property(k7zName, func(w io.Writer) error {
+			return WriteStringVector(w, names)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasComments {
+		err := property(k7zComment, func(w io.Writer) error {
+			return WriteStringVector(w, comments)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, times := range []struct {
+		id      byte
+		defined bool
+		times   []time.Time
+	}{
+		{k7zCTime, hasCTimes, ctimes},
+		{k7zATime, hasATimes, atimes},
+		{k7zMTime, hasMTimes, mtimes},
+	} {
+		if !times.defined {
+			continue
+		}
+
+		err := property(times.id, func(w io.Writer) error {
+			return WriteDateTimeVector(w, times.times)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasAttributes {
+		err := property(k7zWinAttributes, func(w io.Writer) error {
+			return WriteAttributeVector(w, attributes)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return WriteByte(w, k7zEnd)
 }
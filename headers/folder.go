@@ -238,3 +238,112 @@ func ReadBindPairsInfo(r io.Reader) (*BindPairsInfo, error) {
 
 	return bindPairsInfo, nil
 }
+
+// WriteFolder writes a folder structure.
+func WriteFolder(w io.Writer, folder *Folder) error {
+	if len(folder.CoderInfo) == 0 || len(folder.CoderInfo) > MaxCodersInFolder {
+		return ErrInvalidCoderInFolderCount
+	}
+	if len(folder.BindPairsInfo) != len(folder.CoderInfo)-1 {
+		return ErrInvalidCoderInFolderCount
+	}
+
+	if err := WriteNumber(w, uint64(len(folder.CoderInfo))); err != nil {
+		return err
+	}
+	for _, coderInfo := range folder.CoderInfo {
+		if err := WriteCoderInfo(w, coderInfo); err != nil {
+			return err
+		}
+	}
+
+	for _, bindPairsInfo := range folder.BindPairsInfo {
+		if err := WriteBindPairsInfo(w, bindPairsInfo); err != nil {
+			return err
+		}
+	}
+
+	numPackedStreams := folder.NumInStreamsTotal() - len(folder.BindPairsInfo)
+	if numPackedStreams > 1 {
+		if numPackedStreams > MaxPackedStreamsInFolder || len(folder.PackedIndices) != numPackedStreams {
+			return ErrInvalidPackedStreamsCount
+		}
+
+		for _, index := range folder.PackedIndices {
+			if err := WriteNumber(w, uint64(index)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteCoderInfo writes a coder info structure.
+func WriteCoderInfo(w io.Writer, coderInfo *CoderInfo) error {
+	codecIDSize := byte(1)
+	for id := coderInfo.CodecID >> 8; id > 0; id >>= 8 {
+		codecIDSize++
+	}
+
+	isComplexCoder := coderInfo.NumInStreams != 1 || coderInfo.NumOutStreams != 1
+	hasAttributes := len(coderInfo.Properties) > 0
+
+	attributes := codecIDSize
+	if isComplexCoder {
+		attributes |= 0x10
+	}
+	if hasAttributes {
+		attributes |= 0x20
+	}
+	if err := WriteByte(w, attributes); err != nil {
+		return err
+	}
+
+	b := make([]byte, codecIDSize)
+	for i := codecIDSize; i > 0; i-- {
+		b[i-1] = byte(coderInfo.CodecID >> ((codecIDSize - i) * 8))
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+
+	if isComplexCoder {
+		if coderInfo.NumInStreams <= 0 || coderInfo.NumInStreams > MaxInOutStreams {
+			return ErrInvalidStreamCount
+		}
+		if coderInfo.NumOutStreams <= 0 || coderInfo.NumOutStreams > MaxInOutStreams {
+			return ErrInvalidStreamCount
+		}
+
+		if err := WriteNumber(w, uint64(coderInfo.NumInStreams)); err != nil {
+			return err
+		}
+		if err := WriteNumber(w, uint64(coderInfo.NumOutStreams)); err != nil {
+			return err
+		}
+	}
+
+	if hasAttributes {
+		if len(coderInfo.Properties) > MaxPropertyDataSize {
+			return ErrInvalidPropertyDataSize
+		}
+
+		if err := WriteNumber(w, uint64(len(coderInfo.Properties))); err != nil {
+			return err
+		}
+		if _, err := w.Write(coderInfo.Properties); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteBindPairsInfo writes a bindpairs info structure.
+func WriteBindPairsInfo(w io.Writer, bindPairsInfo *BindPairsInfo) error {
+	if err := WriteNumber(w, uint64(bindPairsInfo.InIndex)); err != nil {
+		return err
+	}
+	return WriteNumber(w, uint64(bindPairsInfo.OutIndex))
+}
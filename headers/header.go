@@ -6,6 +6,8 @@ import (
 	"errors"
 	"hash/crc32"
 	"io"
+	"sort"
+	"unicode/utf16"
 )
 
 const (
@@ -72,14 +74,52 @@ func ReadSignatureHeader(r io.Reader) (*SignatureHeader, error) {
 	return &header, err
 }
 
+// WriteSignatureHeader writes the signature header. The start header CRC is
+// calculated from the start header fields.
+func WriteSignatureHeader(w io.Writer, header *SignatureHeader) error {
+	var raw [SignatureHeaderSize]byte
+	copy(raw[:6], MagicBytes[:])
+
+	raw[6] = header.ArchiveVersion.Major
+	raw[7] = header.ArchiveVersion.Minor
+	binary.LittleEndian.PutUint64(raw[12:], uint64(header.StartHeader.NextHeaderOffset))
+	binary.LittleEndian.PutUint64(raw[20:], uint64(header.StartHeader.NextHeaderSize))
+	binary.LittleEndian.PutUint32(raw[28:], header.StartHeader.NextHeaderCRC)
+
+	header.StartHeaderCRC = crc32.ChecksumIEEE(raw[12:])
+	binary.LittleEndian.PutUint32(raw[8:], header.StartHeaderCRC)
+
+	_, err := w.Write(raw[:])
+	return err
+}
+
 // Header is structure containing file and stream information.
 type Header struct {
+	// Comment is the archive's comment, stored as an archive property.
+	Comment string
+
+	// Properties holds any other archive properties, keyed by property type.
+	Properties map[byte][]byte
+
 	MainStreamsInfo *StreamsInfo
 	FilesInfo       []*FileInfo
 }
 
+// StreamsDecoder decodes the streams described by streamsInfo, returning the
+// unpacked data of each folder. It's used to decode a header's additional
+// streams, which hold property data stored outside of the header.
+type StreamsDecoder func(streamsInfo *StreamsInfo) ([][]byte, error)
+
 // ReadPackedStreamsForHeaders reads either a header or encoded header structure.
 func ReadPackedStreamsForHeaders(r *io.LimitedReader) (header *Header, encodedHeader *StreamsInfo, err error) {
+	return ReadPackedStreamsForHeadersWithDecoder(r, nil, 0)
+}
+
+// ReadPackedStreamsForHeadersWithDecoder reads either a header or encoded
+// header structure, using decode to decode any additional streams the header
+// has. If maxFileCount is greater than zero, headers with more files are
+// rejected with a *FileCountError.
+func ReadPackedStreamsForHeadersWithDecoder(r *io.LimitedReader, decode StreamsDecoder, maxFileCount int) (header *Header, encodedHeader *StreamsInfo, err error) {
 	id, err := ReadByte(r)
 	if err != nil {
 		return nil, nil, err
@@ -87,7 +127,7 @@ func ReadPackedStreamsForHeaders(r *io.LimitedReader) (header *Header, encodedHe
 
 	switch id {
 	case k7zHeader:
-		if header, err = ReadHeader(r); err != nil && err != io.EOF {
+		if header, err = ReadHeaderWithDecoder(r, decode, maxFileCount); err != nil && err != io.EOF {
 			return nil, nil, err
 		}
 
@@ -98,21 +138,49 @@ func ReadPackedStreamsForHeaders(r *io.LimitedReader) (header *Header, encodedHe
 
 	case k7zEnd:
 		if header == nil && encodedHeader == nil {
-			return nil, nil, ErrUnexpectedPropertyID
+			return nil, nil, &UnexpectedPropertyIDError{PropertyID: id}
 		}
 		break
 
 	default:
-		return nil, nil, ErrUnexpectedPropertyID
+		return nil, nil, &UnexpectedPropertyIDError{PropertyID: id}
 	}
 
 	return header, encodedHeader, nil
 }
 
-// ReadHeader reads a header structure.
+// WritePackedStreamsForHeaders writes either a header or, if encodedHeader is
+// not nil, an encoded header structure.
+func WritePackedStreamsForHeaders(w io.Writer, header *Header, encodedHeader *StreamsInfo) error {
+	if encodedHeader != nil {
+		if err := WriteByte(w, k7zEncodedHeader); err != nil {
+			return err
+		}
+		return WriteStreamsInfo(w, encodedHeader)
+	}
+
+	if err := WriteByte(w, k7zHeader); err != nil {
+		return err
+	}
+	return WriteHeader(w, header)
+}
+
+// ReadHeader reads a header structure. Headers with additional streams are
+// rejected with ErrAdditionalStreamsNotImplemented.
 func ReadHeader(r *io.LimitedReader) (*Header, error) {
+	return ReadHeaderWithDecoder(r, nil, 0)
+}
+
+// ReadHeaderWithDecoder reads a header structure, using decode to decode any
+// additional streams, so that property data they hold can be read. If
+// maxFileCount is greater than zero, headers with more files are rejected with
+// a *FileCountError.
+func ReadHeaderWithDecoder(r *io.LimitedReader, decode StreamsDecoder, maxFileCount int) (*Header, error) {
 	header := &Header{}
 
+	// hr is switched to also provide additional stream data once decoded
+	var hr io.Reader = r
+
 	for {
 		id, err := ReadByte(r)
 		if err != nil {
@@ -121,32 +189,181 @@ func ReadHeader(r *io.LimitedReader) (*Header, error) {
 
 		switch id {
 		case k7zArchiveProperties:
-			return nil, ErrArchivePropertiesNotImplemented
+			if header.Properties, err = ReadArchiveProperties(r); err != nil {
+				return nil, err
+			}
+			if comment, ok := header.Properties[k7zComment]; ok {
+				header.Comment = decodeUTF16(comment)
+				delete(header.Properties, k7zComment)
+			}
 
 		case k7zAdditionalStreamsInfo:
-			return nil, ErrAdditionalStreamsNotImplemented
+			if decode == nil {
+				return nil, ErrAdditionalStreamsNotImplemented
+			}
+
+			streamsInfo, err := ReadStreamsInfo(r)
+			if err != nil {
+				return nil, err
+			}
+			data, err := decode(streamsInfo)
+			if err != nil {
+				return nil, err
+			}
+			hr = &externalReader{Reader: r, data: data}
 
 		case k7zMainStreamsInfo:
-			if header.MainStreamsInfo, err = ReadStreamsInfo(r); err != nil {
+			if header.MainStreamsInfo, err = ReadStreamsInfo(hr); err != nil {
 				return nil, err
 			}
 
 		case k7zFilesInfo:
 			// Limit the maximum amount of FileInfos that get allocated to size
 			// of the remaining header / 3
-			if header.FilesInfo, err = ReadFilesInfo(r, int(r.N)/3); err != nil {
+			max := int(r.N) / 3
+			if maxFileCount > 0 && maxFileCount < max {
+				max = maxFileCount
+			}
+			if header.FilesInfo, err = ReadFilesInfo(hr, max); err != nil {
 				return nil, err
 			}
 
 		case k7zEnd:
+			// archives of only directories and empty files, as written by
+			// 7-Zip, have no main streams, but files with contents need them
 			if header.MainStreamsInfo == nil {
-				return nil, ErrUnexpectedPropertyID
+				for _, fileInfo := range header.FilesInfo {
+					if !fileInfo.IsEmptyStream {
+						return nil, &UnexpectedPropertyIDError{PropertyID: id}
+					}
+				}
 			}
-
 			return header, nil
 
 		default:
-			return nil, ErrUnexpectedPropertyID
+			return nil, &UnexpectedPropertyIDError{PropertyID: id}
+		}
+	}
+}
+
+// WriteHeader writes a header structure.
+func WriteHeader(w io.Writer, header *Header) error {
+	if header.Comment != "" || len(header.Properties) > 0 {
+		properties := make(map[byte][]byte, len(header.Properties)+1)
+		for propertyType, data := range header.Properties {
+			properties[propertyType] = data
+		}
+		if header.Comment != "" {
+			properties[k7zComment] = encodeUTF16(header.Comment)
+		}
+
+		if err := WriteByte(w, k7zArchiveProperties); err != nil {
+			return err
+		}
+		if err := WriteArchiveProperties(w, properties); err != nil {
+			return err
+		}
+	}
+
+	if header.MainStreamsInfo != nil {
+		if err := WriteByte(w, k7zMainStreamsInfo); err != nil {
+			return err
+		}
+		if err := WriteStreamsInfo(w, header.MainStreamsInfo); err != nil {
+			return err
+		}
+	}
+
+	if len(header.FilesInfo) > 0 {
+		if err := WriteByte(w, k7zFilesInfo); err != nil {
+			return err
+		}
+		if err := WriteFilesInfo(w, header.FilesInfo); err != nil {
+			return err
+		}
+	}
+
+	return WriteByte(w, k7zEnd)
+}
+
+// ReadArchiveProperties reads the archive properties structure, returning the
+// data of each property keyed by property type.
+func ReadArchiveProperties(r *io.LimitedReader) (map[byte][]byte, error) {
+	properties := make(map[byte][]byte)
+
+	for {
+		propertyType, err := ReadByte(r)
+		if err != nil {
+			return nil, err
+		}
+		if propertyType == k7zEnd {
+			return properties, nil
+		}
+
+		size, err := ReadNumber(r)
+		if err != nil {
+			return nil, err
+		}
+		if size > uint64(r.N) {
+			return nil, io.ErrUnexpectedEOF
 		}
+
+		data := make([]byte, size)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		properties[propertyType] = data
+	}
+}
+
+// WriteArchiveProperties writes the archive properties structure, in order of
+// property type.
+func WriteArchiveProperties(w io.Writer, properties map[byte][]byte) error {
+	propertyTypes := make([]int, 0, len(properties))
+	for propertyType := range properties {
+		// a property type of zero marks the end of the properties
+		if propertyType != k7zEnd {
+			propertyTypes = append(propertyTypes, int(propertyType))
+		}
+	}
+	sort.Ints(propertyTypes)
+
+	for _, propertyType := range propertyTypes {
+		data := properties[byte(propertyType)]
+		if err := WriteByte(w, byte(propertyType)); err != nil {
+			return err
+		}
+		if err := WriteNumber(w, uint64(len(data))); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return WriteByte(w, k7zEnd)
+}
+
+// decodeUTF16 decodes a UTF-16 little endian string, which may be null
+// terminated.
+func decodeUTF16(b []byte) string {
+	str := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		str = append(str, c)
+	}
+	return string(utf16.Decode(str))
+}
+
+// encodeUTF16 encodes a null terminated UTF-16 little endian string.
+func encodeUTF16(s string) []byte {
+	str := append(utf16.Encode([]rune(s)), 0)
+	b := make([]byte, len(str)*2)
+	for i, c := range str {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
 	}
+	return b
 }
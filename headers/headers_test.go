@@ -0,0 +1,590 @@
+package headers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+func randTime(r *rand.Rand) time.Time {
+	if r.Intn(4) == 0 {
+		return time.Time{}
+	}
+	// 7z timestamps have a resolution of 100ns
+	return time.Unix(0, (r.Int63n(1<<55)-1<<54)*100)
+}
+
+func randName(r *rand.Rand) string {
+	runes := []rune("abcdefghijklmnopqrstuvwxyz0123456789./-_ éß日本語😀")
+	name := make([]rune, 1+r.Intn(32))
+	for i := range name {
+		name[i] = runes[r.Intn(len(runes))]
+	}
+	return string(name)
+}
+
+func randBytes(r *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	r.Read(b)
+	return b
+}
+
+func randCoderInfo(r *rand.Rand) *CoderInfo {
+	coderInfo := &CoderInfo{
+		CodecID:       r.Uint32() >> uint(r.Intn(32)),
+		NumInStreams:  1,
+		NumOutStreams: 1,
+	}
+	if r.Intn(2) == 0 {
+		coderInfo.NumInStreams = 1 + r.Intn(MaxInOutStreams)
+		coderInfo.NumOutStreams = 1 + r.Intn(MaxInOutStreams)
+	}
+	if n := r.Intn(MaxPropertyDataSize + 1); n > 0 {
+		coderInfo.Properties = make([]byte, n)
+		r.Read(coderInfo.Properties)
+	}
+	return coderInfo
+}
+
+func randFolder(r *rand.Rand) *Folder {
+	for {
+		folder := &Folder{}
+		folder.CoderInfo = make([]*CoderInfo, 1+r.Intn(MaxCodersInFolder))
+		for i := range folder.CoderInfo {
+			folder.CoderInfo[i] = randCoderInfo(r)
+		}
+
+		numInStreams := folder.NumInStreamsTotal()
+		numOutStreams := folder.NumOutStreamsTotal()
+		numBindPairs := len(folder.CoderInfo) - 1
+		numPackedStreams := numInStreams - numBindPairs
+		if numPackedStreams < 1 || numPackedStreams > MaxPackedStreamsInFolder || numBindPairs >= numOutStreams {
+			continue
+		}
+
+		// bind the first in streams to out streams, leaving the remaining in
+		// streams as packed streams
+		ins := r.Perm(numInStreams)
+		outs := r.Perm(numOutStreams)
+		folder.BindPairsInfo = make([]*BindPairsInfo, numBindPairs)
+		for i := range folder.BindPairsInfo {
+			folder.BindPairsInfo[i] = &BindPairsInfo{InIndex: ins[i], OutIndex: outs[i]}
+		}
+		folder.PackedIndices = ins[numBindPairs:]
+
+		folder.UnpackSizes = make([]uint64, numOutStreams)
+		for i := range folder.UnpackSizes {
+			folder.UnpackSizes[i] = uint64(r.Int63n(1 << 40))
+		}
+		if r.Intn(2) == 0 {
+			folder.UnpackCRC = r.Uint32()
+		}
+		return folder
+	}
+}
+
+func randUnpackInfo(r *rand.Rand) *UnpackInfo {
+	unpackInfo := &UnpackInfo{Folders: make([]*Folder, r.Intn(8))}
+	for i := range unpackInfo.Folders {
+		unpackInfo.Folders[i] = randFolder(r)
+	}
+	return unpackInfo
+}
+
+func randSubStreamsInfo(r *rand.Rand, unpackInfo *UnpackInfo) *SubStreamsInfo {
+	subStreamsInfo := &SubStreamsInfo{
+		NumUnpackStreamsInFolders: make([]int, len(unpackInfo.Folders)),
+	}
+
+	for i, folder := range unpackInfo.Folders {
+		num := r.Intn(4)
+		subStreamsInfo.NumUnpackStreamsInFolders[i] = num
+		if num == 0 {
+			continue
+		}
+
+		remaining := folder.UnpackSize()
+		for j := 1; j < num; j++ {
+			size := uint64(r.Int63n(int64(remaining) + 1))
+			remaining -= size
+			subStreamsInfo.UnpackSizes = append(subStreamsInfo.UnpackSizes, size)
+		}
+		subStreamsInfo.UnpackSizes = append(subStreamsInfo.UnpackSizes, remaining)
+
+		if num > 1 || folder.UnpackCRC == 0 {
+			for j := 0; j < num; j++ {
+				subStreamsInfo.Digests = append(subStreamsInfo.Digests, r.Uint32())
+			}
+		}
+	}
+
+	return subStreamsInfo
+}
+
+func randStreamsInfo(r *rand.Rand) *StreamsInfo {
+	streamsInfo := &StreamsInfo{
+		PackInfo:   &PackInfo{PackPos: uint64(r.Int63n(1 << 40)), PackSizes: []uint64{}},
+		UnpackInfo: randUnpackInfo(r),
+	}
+	for _, folder := range streamsInfo.UnpackInfo.Folders {
+		for range folder.PackedIndices {
+			streamsInfo.PackInfo.PackSizes = append(streamsInfo.PackInfo.PackSizes, uint64(r.Int63n(1<<40)))
+		}
+	}
+	if r.Intn(4) > 0 {
+		streamsInfo.SubStreamsInfo = randSubStreamsInfo(r, streamsInfo.UnpackInfo)
+	}
+	return streamsInfo
+}
+
+func randFilesInfo(r *rand.Rand) []*FileInfo {
+	filesInfo := make([]*FileInfo, 1+r.Intn(16))
+	for i := range filesInfo {
+		fi := &FileInfo{
+			Name:       randName(r),
+			CreatedAt:  randTime(r),
+			AccessedAt: randTime(r),
+			ModifiedAt: randTime(r),
+		}
+		if r.Intn(2) == 0 {
+			fi.Attrib = r.Uint32()
+		}
+		if r.Intn(4) == 0 {
+			fi.Comment = randName(r)
+		}
+		if r.Intn(2) == 0 {
+			fi.IsEmptyStream = true
+			fi.IsEmptyFile = r.Intn(2) == 0
+			fi.IsAntiFile = r.Intn(4) == 0
+		}
+		filesInfo[i] = fi
+	}
+	return filesInfo
+}
+
+func equalFilesInfo(a, b []*FileInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name ||
+			a[i].Comment != b[i].Comment ||
+			a[i].Attrib != b[i].Attrib ||
+			a[i].IsEmptyStream != b[i].IsEmptyStream ||
+			a[i].IsEmptyFile != b[i].IsEmptyFile ||
+			a[i].IsAntiFile != b[i].IsAntiFile ||
+			!a[i].CreatedAt.Equal(b[i].CreatedAt) ||
+			!a[i].AccessedAt.Equal(b[i].AccessedAt) ||
+			!a[i].ModifiedAt.Equal(b[i].ModifiedAt) {
+			return false
+		}
+	}
+	return true
+}
+
+// roundTrip checks that the value read back after writing x is equal to x,
+// and that the reader consumed everything that was written.
+func roundTrip(t *testing.T, name string, fn func(r *rand.Rand, buf *bytes.Buffer) bool) {
+	t.Run(name, func(t *testing.T) {
+		err := quick.Check(func(seed int64) bool {
+			buf := new(bytes.Buffer)
+			if !fn(rand.New(rand.NewSource(seed)), buf) {
+				return false
+			}
+			return buf.Len() == 0
+		}, nil)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	roundTrip(t, "Number", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := r.Uint64() >> uint(r.Intn(64))
+		if err := WriteNumber(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadNumber(buf)
+		return err == nil && got == v
+	})
+
+	roundTrip(t, "BoolVector", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := make([]bool, r.Intn(100))
+		for i := range v {
+			v[i] = r.Intn(2) == 0
+		}
+		if err := WriteBoolVector(buf, v); err != nil {
+			return false
+		}
+		got, _, err := ReadBoolVector(buf, len(v))
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "OptionalBoolVector", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := make([]bool, r.Intn(100))
+		for i := range v {
+			v[i] = r.Intn(8) > 0
+		}
+		if err := WriteOptionalBoolVector(buf, v); err != nil {
+			return false
+		}
+		got, _, err := ReadOptionalBoolVector(buf, len(v))
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "NumberVector", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := make([]*int64, r.Intn(100))
+		for i := range v {
+			if r.Intn(4) > 0 {
+				n := r.Int63() - r.Int63()
+				v[i] = &n
+			}
+		}
+		if err := WriteNumberVector(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadNumberVector(buf, len(v))
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "DateTimeVector", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := make([]time.Time, r.Intn(100))
+		for i := range v {
+			v[i] = randTime(r)
+		}
+		if err := WriteDateTimeVector(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadDateTimeVector(buf, len(v))
+		if err != nil || len(got) != len(v) {
+			return false
+		}
+		for i := range v {
+			if !got[i].Equal(v[i]) {
+				return false
+			}
+		}
+		return true
+	})
+
+	roundTrip(t, "AttributeVector", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := make([]uint32, r.Intn(100))
+		for i := range v {
+			if r.Intn(4) > 0 {
+				v[i] = r.Uint32()
+			}
+		}
+		if err := WriteAttributeVector(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadAttributeVector(buf, len(v))
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "Digests", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := make([]uint32, r.Intn(100))
+		for i := range v {
+			if r.Intn(4) > 0 {
+				v[i] = r.Uint32()
+			}
+		}
+		if err := WriteDigests(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadDigests(buf, len(v))
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "SignatureHeader", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := &SignatureHeader{Signature: MagicBytes}
+		v.ArchiveVersion.Minor = byte(r.Intn(5))
+		v.StartHeader.NextHeaderOffset = r.Int63()
+		v.StartHeader.NextHeaderSize = r.Int63n(MaxHeaderSize)
+		v.StartHeader.NextHeaderCRC = r.Uint32()
+		if err := WriteSignatureHeader(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadSignatureHeader(buf)
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "CoderInfo", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := randCoderInfo(r)
+		if err := WriteCoderInfo(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadCoderInfo(buf)
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "Folder", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := randFolder(r)
+		// unpack sizes and crc are stored in the unpack info structure
+		v.UnpackSizes = nil
+		v.UnpackCRC = 0
+		if err := WriteFolder(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadFolder(buf)
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "PackInfo", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := &PackInfo{PackPos: r.Uint64() >> 1, PackSizes: make([]uint64, r.Intn(16))}
+		for i := range v.PackSizes {
+			v.PackSizes[i] = r.Uint64() >> uint(r.Intn(64))
+		}
+		if len(v.PackSizes) > 0 && r.Intn(2) == 0 {
+			v.Digests = make([]uint32, len(v.PackSizes))
+			for i := range v.Digests {
+				if r.Intn(4) > 0 {
+					v.Digests[i] = r.Uint32() | 1
+				}
+			}
+			v.Digests[0] |= 1
+		}
+		if err := WritePackInfo(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadPackInfo(buf)
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "UnpackInfo", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := randUnpackInfo(r)
+		if err := WriteUnpackInfo(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadUnpackInfo(buf)
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "SubStreamsInfo", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		unpackInfo := randUnpackInfo(r)
+		v := randSubStreamsInfo(r, unpackInfo)
+		if err := WriteSubStreamsInfo(buf, v, unpackInfo); err != nil {
+			return false
+		}
+		got, err := ReadSubStreamsInfo(buf, unpackInfo)
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "StreamsInfo", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := randStreamsInfo(r)
+		if err := WriteStreamsInfo(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadStreamsInfo(buf)
+		return err == nil && reflect.DeepEqual(got, v)
+	})
+
+	roundTrip(t, "FilesInfo", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := randFilesInfo(r)
+		if err := WriteFilesInfo(buf, v); err != nil {
+			return false
+		}
+		got, err := ReadFilesInfo(buf, len(v))
+		return err == nil && equalFilesInfo(got, v)
+	})
+
+	roundTrip(t, "Header", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := &Header{FilesInfo: randFilesInfo(r)}
+		if r.Intn(4) > 0 {
+			v.MainStreamsInfo = randStreamsInfo(r)
+		} else {
+			// without streams, every file has to be empty
+			for _, fi := range v.FilesInfo {
+				fi.IsEmptyStream = true
+			}
+		}
+		if r.Intn(4) == 0 {
+			v.Comment = randName(r)
+		}
+		if r.Intn(4) == 0 {
+			v.Properties = map[byte][]byte{0x80: randBytes(r, 16), 0xff: randBytes(r, 64)}
+		}
+		if err := WritePackedStreamsForHeaders(buf, v, nil); err != nil {
+			return false
+		}
+		got, encoded, err := ReadPackedStreamsForHeaders(&io.LimitedReader{R: buf, N: int64(buf.Len())})
+		return err == nil && encoded == nil &&
+			got.Comment == v.Comment &&
+			len(got.Properties) == len(v.Properties) &&
+			(len(v.Properties) == 0 || reflect.DeepEqual(got.Properties, v.Properties)) &&
+			reflect.DeepEqual(got.MainStreamsInfo, v.MainStreamsInfo) &&
+			equalFilesInfo(got.FilesInfo, v.FilesInfo)
+	})
+
+	roundTrip(t, "EncodedHeader", func(r *rand.Rand, buf *bytes.Buffer) bool {
+		v := randStreamsInfo(r)
+		if err := WritePackedStreamsForHeaders(buf, nil, v); err != nil {
+			return false
+		}
+		header, got, err := ReadPackedStreamsForHeaders(&io.LimitedReader{R: buf, N: int64(buf.Len())})
+		return err == nil && header == nil && reflect.DeepEqual(got, v)
+	})
+}
+
+func TestFileInfoMode(t *testing.T) {
+	unix := func(mode uint32) uint32 {
+		return mode<<16 | FileAttributeUnixExtension
+	}
+
+	tests := []struct {
+		fi      FileInfo
+		mode    os.FileMode
+		symlink bool
+	}{
+		{FileInfo{}, 0644, false},
+		{FileInfo{Attrib: FileAttributeReadonly}, 0444, false},
+		{FileInfo{IsEmptyStream: true}, os.ModeDir | 0755, false},
+		{FileInfo{IsEmptyStream: true, IsEmptyFile: true}, 0644, false},
+		{FileInfo{Attrib: FileAttributeDirectory | FileAttributeReadonly}, os.ModeDir | 0555, false},
+		{FileInfo{Attrib: unix(0100600)}, 0600, false},
+		{FileInfo{Attrib: unix(0104755)}, os.ModeSetuid | 0755, false},
+		{FileInfo{Attrib: unix(0040700) | FileAttributeDirectory}, os.ModeDir | 0700, false},
+		{FileInfo{Attrib: unix(0000750), IsEmptyStream: true}, os.ModeDir | 0750, false},
+		{FileInfo{Attrib: unix(0120777)}, os.ModeSymlink | 0777, true},
+		{FileInfo{Attrib: unix(0010644)}, os.ModeNamedPipe | 0644, false},
+	}
+
+	for _, tc := range tests {
+		if mode := tc.fi.Mode(); mode != tc.mode {
+			t.Errorf("attrib %#x: expected mode %v, got %v", tc.fi.Attrib, tc.mode, mode)
+		}
+		if isDir := tc.fi.IsDir(); isDir != tc.mode.IsDir() {
+			t.Errorf("attrib %#x: expected IsDir %v, got %v", tc.fi.Attrib, tc.mode.IsDir(), isDir)
+		}
+		if symlink := tc.fi.IsSymlink(); symlink != tc.symlink {
+			t.Errorf("attrib %#x: expected IsSymlink %v, got %v", tc.fi.Attrib, tc.symlink, symlink)
+		}
+	}
+}
+
+func TestReadHeaderAdditionalStreams(t *testing.T) {
+	names := new(bytes.Buffer)
+	if err := WriteStringVector(names, []string{"a.txt", "b.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	attributes := []byte{0x20, 0, 0, 0, 0x01, 0, 0, 0}
+
+	write := func(dataIndex uint64) []byte {
+		buf := new(bytes.Buffer)
+		WriteByte(buf, k7zAdditionalStreamsInfo)
+		WriteStreamsInfo(buf, &StreamsInfo{
+			PackInfo:   &PackInfo{PackSizes: []uint64{8}},
+			UnpackInfo: &UnpackInfo{Folders: []*Folder{randFolder(rand.New(rand.NewSource(1)))}},
+		})
+
+		WriteByte(buf, k7zFilesInfo)
+		WriteNumber(buf, 2)
+		WriteByte(buf, k7zEmptyStream) // there are no main streams
+		WriteNumber(buf, 1)
+		WriteByte(buf, 0xc0)
+		WriteByte(buf, k7zName)
+		WriteNumber(buf, 2)
+		WriteByte(buf, 1) // external
+		WriteNumber(buf, dataIndex)
+		WriteByte(buf, k7zWinAttributes)
+		WriteNumber(buf, 3)
+		WriteByte(buf, 1) // all defined
+		WriteByte(buf, 1) // external
+		WriteNumber(buf, 1)
+		WriteByte(buf, k7zEnd)
+
+		WriteByte(buf, k7zEnd)
+		return buf.Bytes()
+	}
+
+	decode := func(streamsInfo *StreamsInfo) ([][]byte, error) {
+		// names are stored after the external flag
+		return [][]byte{names.Bytes()[1:], attributes}, nil
+	}
+
+	b := write(0)
+	header, err := ReadHeaderWithDecoder(&io.LimitedReader{R: bytes.NewReader(b), N: int64(len(b))}, decode, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(header.FilesInfo) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(header.FilesInfo))
+	}
+	for i, expected := range []FileInfo{{Name: "a.txt", Attrib: 0x20}, {Name: "b.txt", Attrib: 0x1}} {
+		if fi := header.FilesInfo[i]; fi.Name != expected.Name || fi.Attrib != expected.Attrib {
+			t.Errorf("expected %q with attrib %#x, got %q with attrib %#x", expected.Name, expected.Attrib, fi.Name, fi.Attrib)
+		}
+	}
+
+	if _, err = ReadHeader(&io.LimitedReader{R: bytes.NewReader(b), N: int64(len(b))}); err != ErrAdditionalStreamsNotImplemented {
+		t.Fatalf("expected ErrAdditionalStreamsNotImplemented without a decoder, got %v", err)
+	}
+
+	b = write(2)
+	if _, err = ReadHeaderWithDecoder(&io.LimitedReader{R: bytes.NewReader(b), N: int64(len(b))}, decode, 0); err != ErrInvalidDataIndex {
+		t.Fatalf("expected ErrInvalidDataIndex, got %v", err)
+	}
+}
+
+func TestReadHeaderWithoutMainStreams(t *testing.T) {
+	files := []*FileInfo{{Name: "dir", IsEmptyStream: true}, {Name: "empty.txt", IsEmptyStream: true, IsEmptyFile: true}}
+
+	buf := new(bytes.Buffer)
+	if err := WriteHeader(buf, &Header{FilesInfo: files}); err != nil {
+		t.Fatal(err)
+	}
+	header, err := ReadHeader(&io.LimitedReader{R: buf, N: int64(buf.Len())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.MainStreamsInfo != nil || len(header.FilesInfo) != 2 {
+		t.Fatalf("unexpected header %+v", header)
+	}
+
+	// a file with contents needs the main streams
+	files[1].IsEmptyStream = false
+	buf.Reset()
+	if err := WriteHeader(buf, &Header{FilesInfo: files}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadHeader(&io.LimitedReader{R: buf, N: int64(buf.Len())}); !errors.Is(err, ErrUnexpectedPropertyID) {
+		t.Fatalf("expected ErrUnexpectedPropertyID, got %v", err)
+	}
+}
+
+func TestFolderMethod(t *testing.T) {
+	coder := func(id uint32, props ...byte) *CoderInfo {
+		return &CoderInfo{CodecID: id, Properties: props, NumInStreams: 1, NumOutStreams: 1}
+	}
+
+	tests := []struct {
+		coders []*CoderInfo
+		method string
+	}{
+		{[]*CoderInfo{coder(0x00)}, "Copy"},
+		{[]*CoderInfo{coder(0x21, 24)}, "LZMA2:24"},
+		{[]*CoderInfo{coder(0x21, 25)}, "LZMA2:24m"},
+		{[]*CoderInfo{coder(0x21, 40)}, "LZMA2:4294967295b"},
+		{[]*CoderInfo{coder(0x030101, 0x5d, 0, 0, 0, 1)}, "LZMA:24"},
+		{[]*CoderInfo{coder(0x030101, 0x5d, 0, 0, 3, 0)}, "LZMA:192k"},
+		{[]*CoderInfo{coder(0x030101, 9*2, 0, 0, 16, 0)}, "LZMA:20:lc0:lp2:pb0"},
+		{[]*CoderInfo{coder(0x030401, 6, 0, 0, 0, 1)}, "PPMD:o6:mem24"},
+		{[]*CoderInfo{coder(0x03, 3)}, "Delta:4"},
+		{[]*CoderInfo{coder(0x04f71101)}, "ZSTD"},
+		{[]*CoderInfo{coder(0xdead)}, "DEAD"},
+		{[]*CoderInfo{coder(0x06f10701, 0xd3, 0x07), coder(0x21, 24), coder(0x03030103)}, "BCJ LZMA2:24 7zAES:19"},
+	}
+
+	for _, tc := range tests {
+		folder := &Folder{CoderInfo: tc.coders}
+		if method := folder.Method(); method != tc.method {
+			t.Errorf("expected %q, got %q", tc.method, method)
+		}
+	}
+}
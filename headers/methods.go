@@ -0,0 +1,131 @@
+package headers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// methodNames maps codec IDs to the method names used by 7-Zip.
+var methodNames = map[uint32]string{
+	0x00:       "Copy",
+	0x03:       "Delta",
+	0x0a:       "ARM64",
+	0x0b:       "RISCV",
+	0x21:       "LZMA2",
+	0x020302:   "Swap2",
+	0x020304:   "Swap4",
+	0x030101:   "LZMA",
+	0x03030103: "BCJ",
+	0x0303011b: "BCJ2",
+	0x03030205: "PPC",
+	0x03030401: "IA64",
+	0x03030501: "ARM",
+	0x03030701: "ARMT",
+	0x03030805: "SPARC",
+	0x030401:   "PPMD",
+	0x040108:   "Deflate",
+	0x040109:   "Deflate64",
+	0x040202:   "BZip2",
+	0x04f71101: "ZSTD",
+	0x04f71102: "BROTLI",
+	0x04f71104: "LZ4",
+	0x04f71105: "LZ5",
+	0x04f71106: "LIZARD",
+	0x06f10701: "7zAES",
+}
+
+// MethodName returns the 7-Zip name of a codec, such as "LZMA2" or "BCJ2". The
+// codec ID is returned in hexadecimal if the codec is unknown.
+func MethodName(codecID uint32) string {
+	if name, ok := methodNames[codecID]; ok {
+		return name
+	}
+	return fmt.Sprintf("%X", codecID)
+}
+
+// Method returns the coder's method name followed by a summary of its
+// properties, such as "LZMA2:24" or "PPMD:o6:mem24".
+func (c *CoderInfo) Method() string {
+	method := MethodName(c.CodecID)
+	props := c.Properties
+
+	switch c.CodecID {
+	case 0x21: // lzma2
+		if len(props) == 1 {
+			switch {
+			case props[0] > 40:
+			case props[0] == 40:
+				method += ":" + sizeString(0xffffffff)
+			default:
+				method += ":" + sizeString(uint32(2|(props[0]&1))<<(props[0]/2+11))
+			}
+		}
+
+	case 0x030101: // lzma
+		if len(props) == 5 {
+			method += ":" + sizeString(binary.LittleEndian.Uint32(props[1:]))
+
+			// only the non-default literal and position bits are shown
+			d := uint32(props[0])
+			lc, lp, pb := d%9, d/9%5, d/45
+			if lc != 3 {
+				method += ":lc" + strconv.Itoa(int(lc))
+			}
+			if lp != 0 {
+				method += ":lp" + strconv.Itoa(int(lp))
+			}
+			if pb != 2 {
+				method += ":pb" + strconv.Itoa(int(pb))
+			}
+		}
+
+	case 0x030401: // ppmd
+		if len(props) == 5 {
+			method += ":o" + strconv.Itoa(int(props[0])) + ":mem" + sizeString(binary.LittleEndian.Uint32(props[1:]))
+		}
+
+	case 0x03: // delta
+		if len(props) == 1 {
+			method += ":" + strconv.Itoa(int(props[0])+1)
+		}
+
+	case 0x06f10701: // aes
+		if len(props) > 0 {
+			method += ":" + strconv.Itoa(int(props[0]&0x3f))
+		}
+	}
+
+	return method
+}
+
+// Method returns the methods used by the folder's coders in the style of
+// 7-Zip, such as "BCJ LZMA2:24 7zAES:19". Like 7-Zip, coders are listed in
+// reverse order, which for most archives starts with the coder producing the
+// folder's contents.
+func (f *Folder) Method() string {
+	methods := make([]string, len(f.CoderInfo))
+	for i := range f.CoderInfo {
+		methods[len(methods)-1-i] = f.CoderInfo[i].Method()
+	}
+	return strings.Join(methods, " ")
+}
+
+// sizeString formats a dictionary or memory size as 7-Zip does: a power of two
+// as its exponent, otherwise in the largest whole unit.
+func sizeString(size uint32) string {
+	for i := uint(0); i < 32; i++ {
+		if size == 1<<i {
+			return strconv.Itoa(int(i))
+		}
+	}
+
+	switch {
+	case size%(1<<20) == 0:
+		return strconv.Itoa(int(size>>20)) + "m"
+	case size%(1<<10) == 0:
+		return strconv.Itoa(int(size>>10)) + "k"
+	}
+	return strconv.Itoa(int(size)) + "b"
+}
@@ -6,6 +6,10 @@ import "io"
 type PackInfo struct {
 	PackPos   uint64
 	PackSizes []uint64
+
+	// Digests are the CRCs of each pack stream, if present. A CRC of zero is
+	// undefined.
+	Digests []uint32
 }
 
 // ReadPackInfo reads a pack info structure.
@@ -30,8 +34,8 @@ func ReadPackInfo(r io.Reader) (*PackInfo, error) {
 
 		switch id {
 		case k7zSize:
-			packInfo.PackSizes = make([]uint64, numPackStreams+1)
-			for i := 0; i < numPackStreams; i++ {
+			packInfo.PackSizes = make([]uint64, numPackStreams)
+			for i := range packInfo.PackSizes {
 				packInfo.PackSizes[i], err = ReadNumber(r)
 				if err != nil {
 					return nil, err
@@ -39,13 +43,50 @@ func ReadPackInfo(r io.Reader) (*PackInfo, error) {
 			}
 
 		case k7zCRC:
-			return nil, ErrPackInfoCRCsNotImplemented
+			if packInfo.Digests, err = ReadDigests(r, numPackStreams); err != nil {
+				return nil, err
+			}
 
 		case k7zEnd:
 			return packInfo, nil
 
 		default:
-			return nil, ErrUnexpectedPropertyID
+			return nil, &UnexpectedPropertyIDError{PropertyID: id}
 		}
 	}
 }
+
+// WritePackInfo writes a pack info structure.
+func WritePackInfo(w io.Writer, packInfo *PackInfo) error {
+	if err := WriteNumber(w, packInfo.PackPos); err != nil {
+		return err
+	}
+	if err := WriteNumber(w, uint64(len(packInfo.PackSizes))); err != nil {
+		return err
+	}
+
+	if err := WriteByte(w, k7zSize); err != nil {
+		return err
+	}
+	for _, size := range packInfo.PackSizes {
+		if err := WriteNumber(w, size); err != nil {
+			return err
+		}
+	}
+
+	for _, crc := range packInfo.Digests {
+		if crc == 0 {
+			continue
+		}
+
+		if err := WriteByte(w, k7zCRC); err != nil {
+			return err
+		}
+		if err := WriteDigests(w, packInfo.Digests); err != nil {
+			return err
+		}
+		break
+	}
+
+	return WriteByte(w, k7zEnd)
+}
@@ -1,10 +1,13 @@
 package headers
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"time"
+	"unicode/utf16"
 )
 
 const (
@@ -43,25 +46,81 @@ var (
 	// either unexpected, or we don't support.
 	ErrUnexpectedPropertyID = errors.New("unexpected property id")
 
-	// ErrAdditionalStreamsNotImplemented is returned for archives using
-	// additional streams. These were apparently used in older versions of 7zip.
+	// ErrAdditionalStreamsNotImplemented is returned for headers using
+	// additional streams when no StreamsDecoder is provided. These were
+	// apparently used in older versions of 7zip.
 	ErrAdditionalStreamsNotImplemented = errors.New("additional streams are not implemented")
 
-	// ErrArchivePropertiesNotImplemented is returned if archive properties
-	// structure is found. So far, this hasn't been used in any verison of 7zip.
+	// ErrArchivePropertiesNotImplemented was returned if archive properties
+	// structure was found.
+	//
+	// Deprecated: archive properties are read into Header.Properties.
 	ErrArchivePropertiesNotImplemented = errors.New("archive properties are not implemented")
 
 	// ErrChecksumMismatch is returned when a CRC check fails.
 	ErrChecksumMismatch = errors.New("checksum mismatch")
 
-	// ErrPackInfoCRCsNotImplemented is returned if a CRC property id is
+	// ErrPackInfoCRCsNotImplemented was returned if a CRC property id was
 	// encountered whilst reading packinfo.
+	//
+	// Deprecated: pack stream CRCs are read into PackInfo.Digests.
 	ErrPackInfoCRCsNotImplemented = errors.New("packinfo crcs are not implemented")
 
 	// ErrInvalidNumber is returned when a number read exceeds 0x7FFFFFFF
 	ErrInvalidNumber = errors.New("invalid number")
+
+	// ErrInvalidDataIndex is returned when external data references an
+	// additional stream that doesn't exist.
+	ErrInvalidDataIndex = errors.New("invalid external data index")
 )
 
+// UnexpectedPropertyIDError is returned when a property id is read that was
+// either unexpected, or isn't supported.
+type UnexpectedPropertyIDError struct {
+	PropertyID byte
+}
+
+func (e *UnexpectedPropertyIDError) Error() string {
+	return fmt.Sprintf("%v %#02x", ErrUnexpectedPropertyID, e.PropertyID)
+}
+
+// Unwrap returns ErrUnexpectedPropertyID.
+func (e *UnexpectedPropertyIDError) Unwrap() error {
+	return ErrUnexpectedPropertyID
+}
+
+// externalReader is a header reader that also provides the decoded data of
+// the header's additional streams, which properties can reference instead of
+// holding their data inline.
+type externalReader struct {
+	io.Reader
+	data [][]byte
+}
+
+// readExternal reads the external flag that precedes property data, returning
+// the reader holding the data: either r itself or the referenced additional
+// stream.
+func readExternal(r io.Reader) (io.Reader, error) {
+	external, err := ReadByte(r)
+	if err != nil {
+		return nil, err
+	}
+	if external == 0 {
+		return r, nil
+	}
+
+	dataIndex, err := ReadNumberInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	er, ok := r.(*externalReader)
+	if !ok || dataIndex >= len(er.data) {
+		return nil, ErrInvalidDataIndex
+	}
+	return bytes.NewReader(er.data[dataIndex]), nil
+}
+
 // ReadByte reads a single byte.
 func ReadByte(r io.Reader) (byte, error) {
 	var val [1]byte
@@ -76,7 +135,7 @@ func ReadByteExpect(r io.Reader, val byte) error {
 		return err
 	}
 	if value != val {
-		return ErrUnexpectedPropertyID
+		return &UnexpectedPropertyIDError{PropertyID: value}
 	}
 	return nil
 }
@@ -184,13 +243,9 @@ func ReadNumberVector(r io.Reader, numFiles int) ([]*int64, error) {
 		return nil, err
 	}
 
-	external, err := ReadByte(r)
-	if err != nil {
+	if r, err = readExternal(r); err != nil {
 		return nil, err
 	}
-	if external != 0 {
-		return nil, ErrAdditionalStreamsNotImplemented
-	}
 
 	numbers := make([]*int64, numFiles)
 	for i := 0; i < numFiles; i++ {
@@ -238,13 +293,9 @@ func ReadAttributeVector(r io.Reader, numFiles int) ([]uint32, error) {
 		return nil, err
 	}
 
-	external, err := ReadByte(r)
-	if err != nil {
+	if r, err = readExternal(r); err != nil {
 		return nil, err
 	}
-	if external != 0 {
-		return nil, ErrAdditionalStreamsNotImplemented
-	}
 
 	attributes := make([]uint32, numFiles)
 	for i := range attributes {
@@ -260,3 +311,194 @@ func ReadAttributeVector(r io.Reader, numFiles int) ([]uint32, error) {
 
 	return attributes, nil
 }
+
+// ReadStringVector reads a vector of null terminated UTF-16 strings.
+func ReadStringVector(r io.Reader, numFiles int) ([]string, error) {
+	r, err := readExternal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, numFiles)
+	for i := range strs {
+		var rune uint16
+		var str []uint16
+		for {
+			if err = binary.Read(r, binary.LittleEndian, &rune); err != nil {
+				return nil, err
+			}
+
+			if rune == 0 {
+				break
+			}
+			str = append(str, rune)
+		}
+		strs[i] = string(utf16.Decode(str))
+	}
+
+	return strs, nil
+}
+
+// WriteByte writes a single byte.
+func WriteByte(w io.Writer, val byte) error {
+	_, err := w.Write([]byte{val})
+	return err
+}
+
+// WriteNumber writes a 7z encoded uint64.
+func WriteNumber(w io.Writer, value uint64) error {
+	var buf [9]byte
+
+	first := byte(0)
+	mask := byte(0x80)
+
+	var i int
+	for i = 0; i < 8; i++ {
+		if value < uint64(1)<<(7*uint(i+1)) {
+			first |= byte(value >> (8 * uint(i)))
+			break
+		}
+		first |= mask
+		mask >>= 1
+	}
+
+	buf[0] = first
+	for j := 0; j < i; j++ {
+		buf[j+1] = byte(value >> (8 * uint(j)))
+	}
+
+	_, err := w.Write(buf[:i+1])
+	return err
+}
+
+// WriteUint32 writes a uint32.
+func WriteUint32(w io.Writer, v uint32) error {
+	return binary.Write(w, binary.LittleEndian, v)
+}
+
+// WriteUint64 writes a uint64.
+func WriteUint64(w io.Writer, v uint64) error {
+	return binary.Write(w, binary.LittleEndian, v)
+}
+
+// WriteBoolVector writes a vector of boolean values.
+func WriteBoolVector(w io.Writer, v []bool) error {
+	buf := make([]byte, (len(v)+7)/8)
+	for i := range v {
+		if v[i] {
+			buf[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// WriteOptionalBoolVector writes a vector of boolean values, or a single
+// marker byte if all values are true.
+func WriteOptionalBoolVector(w io.Writer, v []bool) error {
+	allDefined := true
+	for i := range v {
+		if !v[i] {
+			allDefined = false
+			break
+		}
+	}
+
+	if allDefined {
+		return WriteByte(w, 1)
+	}
+
+	if err := WriteByte(w, 0); err != nil {
+		return err
+	}
+	return WriteBoolVector(w, v)
+}
+
+// WriteNumberVector writes a vector of int64s. Nil values are marked as
+// undefined.
+func WriteNumberVector(w io.Writer, numbers []*int64) error {
+	defined := make([]bool, len(numbers))
+	for i := range numbers {
+		defined[i] = numbers[i] != nil
+	}
+
+	if err := WriteOptionalBoolVector(w, defined); err != nil {
+		return err
+	}
+
+	// external
+	if err := WriteByte(w, 0); err != nil {
+		return err
+	}
+
+	for i := range numbers {
+		if numbers[i] != nil {
+			if err := WriteUint64(w, uint64(*numbers[i])); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteDateTimeVector writes a vector of datetime values. Zero times are
+// marked as undefined.
+func WriteDateTimeVector(w io.Writer, times []time.Time) error {
+	timestamps := make([]*int64, len(times))
+	for i := range times {
+		if !times[i].IsZero() {
+			nsec := times[i].UnixNano()
+			nsec /= 100
+			nsec += 116444736000000000
+
+			timestamps[i] = &nsec
+		}
+	}
+
+	return WriteNumberVector(w, timestamps)
+}
+
+// WriteStringVector writes a vector of null terminated UTF-16 strings.
+func WriteStringVector(w io.Writer, strs []string) error {
+	// external
+	if err := WriteByte(w, 0); err != nil {
+		return err
+	}
+
+	for _, str := range strs {
+		if err := binary.Write(w, binary.LittleEndian, append(utf16.Encode([]rune(str)), 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteAttributeVector writes a vector of uint32s. Zero values are marked as
+// undefined.
+func WriteAttributeVector(w io.Writer, attributes []uint32) error {
+	defined := make([]bool, len(attributes))
+	for i := range attributes {
+		defined[i] = attributes[i] != 0
+	}
+
+	if err := WriteOptionalBoolVector(w, defined); err != nil {
+		return err
+	}
+
+	// external
+	if err := WriteByte(w, 0); err != nil {
+		return err
+	}
+
+	for i := range attributes {
+		if defined[i] {
+			if err := WriteUint32(w, attributes[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -34,7 +34,7 @@ func ReadStreamsInfo(r io.Reader) (*StreamsInfo, error) {
 
 		case k7zSubStreamsInfo:
 			if streamsInfo.UnpackInfo == nil {
-				return nil, ErrUnexpectedPropertyID
+				return nil, &UnexpectedPropertyIDError{PropertyID: id}
 			}
 
 			if streamsInfo.SubStreamsInfo, err = ReadSubStreamsInfo(r, streamsInfo.UnpackInfo); err != nil {
@@ -43,13 +43,13 @@ func ReadStreamsInfo(r io.Reader) (*StreamsInfo, error) {
 
 		case k7zEnd:
 			if streamsInfo.PackInfo == nil || streamsInfo.UnpackInfo == nil {
-				return nil, ErrUnexpectedPropertyID
+				return nil, &UnexpectedPropertyIDError{PropertyID: id}
 			}
 
 			return streamsInfo, nil
 
 		default:
-			return nil, ErrUnexpectedPropertyID
+			return nil, &UnexpectedPropertyIDError{PropertyID: id}
 		}
 	}
 }
@@ -136,8 +136,105 @@ func ReadSubStreamsInfo(r io.Reader, unpackInfo *UnpackInfo) (*SubStreamsInfo, e
 	}
 
 	if id != k7zEnd {
-		return nil, ErrUnexpectedPropertyID
+		return nil, &UnexpectedPropertyIDError{PropertyID: id}
 	}
 
 	return subStreamInfo, nil
 }
+
+// WriteStreamsInfo writes the streams info structure.
+func WriteStreamsInfo(w io.Writer, streamsInfo *StreamsInfo) error {
+	if streamsInfo.PackInfo == nil || streamsInfo.UnpackInfo == nil {
+		return ErrUnexpectedPropertyID
+	}
+
+	if err := WriteByte(w, k7zPackInfo); err != nil {
+		return err
+	}
+	if err := WritePackInfo(w, streamsInfo.PackInfo); err != nil {
+		return err
+	}
+
+	if err := WriteByte(w, k7zUnpackInfo); err != nil {
+		return err
+	}
+	if err := WriteUnpackInfo(w, streamsInfo.UnpackInfo); err != nil {
+		return err
+	}
+
+	if streamsInfo.SubStreamsInfo != nil {
+		if err := WriteByte(w, k7zSubStreamsInfo); err != nil {
+			return err
+		}
+		if err := WriteSubStreamsInfo(w, streamsInfo.SubStreamsInfo, streamsInfo.UnpackInfo); err != nil {
+			return err
+		}
+	}
+
+	return WriteByte(w, k7zEnd)
+}
+
+// WriteSubStreamsInfo writes the substreams info structure.
+func WriteSubStreamsInfo(w io.Writer, subStreamsInfo *SubStreamsInfo, unpackInfo *UnpackInfo) error {
+	if len(subStreamsInfo.NumUnpackStreamsInFolders) != len(unpackInfo.Folders) {
+		return ErrUnexpectedPropertyID
+	}
+
+	hasNumUnpackStreams := false
+	hasSizes := false
+	for _, num := range subStreamsInfo.NumUnpackStreamsInFolders {
+		if num != 1 {
+			hasNumUnpackStreams = true
+		}
+		if num > 1 {
+			hasSizes = true
+		}
+	}
+
+	if hasNumUnpackStreams {
+		if err := WriteByte(w, k7zNumUnpackStream); err != nil {
+			return err
+		}
+		for _, num := range subStreamsInfo.NumUnpackStreamsInFolders {
+			if err := WriteNumber(w, uint64(num)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if hasSizes {
+		if err := WriteByte(w, k7zSize); err != nil {
+			return err
+		}
+
+		sizes := subStreamsInfo.UnpackSizes
+		for _, num := range subStreamsInfo.NumUnpackStreamsInFolders {
+			if num == 0 {
+				continue
+			}
+			if num > len(sizes) {
+				return ErrUnexpectedPropertyID
+			}
+
+			// the last size of each folder is implied by the folder's
+			// unpack size
+			for _, size := range sizes[:num-1] {
+				if err := WriteNumber(w, size); err != nil {
+					return err
+				}
+			}
+			sizes = sizes[num:]
+		}
+	}
+
+	if len(subStreamsInfo.Digests) > 0 {
+		if err := WriteByte(w, k7zCRC); err != nil {
+			return err
+		}
+		if err := WriteDigests(w, subStreamsInfo.Digests); err != nil {
+			return err
+		}
+	}
+
+	return WriteByte(w, k7zEnd)
+}
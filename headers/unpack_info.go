@@ -31,23 +31,18 @@ func ReadUnpackInfo(r io.Reader) (*UnpackInfo, error) {
 		return nil, ErrInvalidCountExceeded
 	}
 
-	unpackInfo := &UnpackInfo{}
-	external, err := ReadByte(r)
+	// folders can be held in an additional stream
+	fr, err := readExternal(r)
 	if err != nil {
 		return nil, err
 	}
 
-	switch external {
-	case 0:
-		unpackInfo.Folders = make([]*Folder, numFolders)
-		for i := range unpackInfo.Folders {
-			if unpackInfo.Folders[i], err = ReadFolder(r); err != nil {
-				return nil, err
-			}
+	unpackInfo := &UnpackInfo{}
+	unpackInfo.Folders = make([]*Folder, numFolders)
+	for i := range unpackInfo.Folders {
+		if unpackInfo.Folders[i], err = ReadFolder(fr); err != nil {
+			return nil, err
 		}
-
-	default:
-		return nil, ErrAdditionalStreamsNotImplemented
 	}
 
 	if err = ReadByteExpect(r, k7zCodersUnpackSize); err != nil {
@@ -82,8 +77,63 @@ func ReadUnpackInfo(r io.Reader) (*UnpackInfo, error) {
 	}
 
 	if id != k7zEnd {
-		return nil, ErrUnexpectedPropertyID
+		return nil, &UnexpectedPropertyIDError{PropertyID: id}
 	}
 
 	return unpackInfo, nil
 }
+
+// WriteUnpackInfo writes an unpack info structure.
+func WriteUnpackInfo(w io.Writer, unpackInfo *UnpackInfo) error {
+	if err := WriteByte(w, k7zFolder); err != nil {
+		return err
+	}
+	if err := WriteNumber(w, uint64(len(unpackInfo.Folders))); err != nil {
+		return err
+	}
+
+	// external
+	if err := WriteByte(w, 0); err != nil {
+		return err
+	}
+
+	for _, folder := range unpackInfo.Folders {
+		if err := WriteFolder(w, folder); err != nil {
+			return err
+		}
+	}
+
+	if err := WriteByte(w, k7zCodersUnpackSize); err != nil {
+		return err
+	}
+	for _, folder := range unpackInfo.Folders {
+		if len(folder.UnpackSizes) != folder.NumOutStreamsTotal() {
+			return ErrInvalidStreamCount
+		}
+		for _, size := range folder.UnpackSizes {
+			if err := WriteNumber(w, size); err != nil {
+				return err
+			}
+		}
+	}
+
+	crcs := make([]uint32, len(unpackInfo.Folders))
+	hasCRCs := false
+	for i, folder := range unpackInfo.Folders {
+		crcs[i] = folder.UnpackCRC
+		if crcs[i] != 0 {
+			hasCRCs = true
+		}
+	}
+
+	if hasCRCs {
+		if err := WriteByte(w, k7zCRC); err != nil {
+			return err
+		}
+		if err := WriteDigests(w, crcs); err != nil {
+			return err
+		}
+	}
+
+	return WriteByte(w, k7zEnd)
+}
@@ -0,0 +1,224 @@
+package go7z
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/saracen/go7z/headers"
+)
+
+// TestStatus is the outcome of testing part of an archive.
+type TestStatus int
+
+const (
+	// TestOK is reported when the data was decoded and matched its CRC.
+	TestOK TestStatus = iota
+
+	// TestChecksumMismatch is reported when the data was decoded, but didn't
+	// match its CRC.
+	TestChecksumMismatch
+
+	// TestDecoderError is reported when the data couldn't be decoded.
+	TestDecoderError
+
+	// TestTruncated is reported when the data ended before its expected size.
+	TestTruncated
+)
+
+func (s TestStatus) String() string {
+	switch s {
+	case TestOK:
+		return "OK"
+	case TestChecksumMismatch:
+		return "CRC mismatch"
+	case TestDecoderError:
+		return "decoder error"
+	case TestTruncated:
+		return "truncated"
+	}
+	return "unknown"
+}
+
+// FileTestResult is the outcome of testing a file.
+type FileTestResult struct {
+	File   *File
+	Status TestStatus
+	Err    error
+}
+
+// FolderTestResult is the outcome of testing a folder's packed streams and, if
+// it has one, the CRC of its entire unpacked contents.
+type FolderTestResult struct {
+	Folder int
+	Status TestStatus
+	Err    error
+}
+
+// TestReport is the outcome of testing an archive with Reader.Test.
+type TestReport struct {
+	// Header is the outcome of checking the signature header and header CRCs.
+	Header    TestStatus
+	HeaderErr error
+
+	// Files holds the outcome of each file, in archive order.
+	Files []FileTestResult
+
+	// Folders holds the outcome of each folder.
+	Folders []FolderTestResult
+}
+
+// OK returns whether every part of the archive tested OK.
+func (r *TestReport) OK() bool {
+	if r.Header != TestOK {
+		return false
+	}
+	for _, f := range r.Files {
+		if f.Status != TestOK {
+			return false
+		}
+	}
+	for _, f := range r.Folders {
+		if f.Status != TestOK {
+			return false
+		}
+	}
+	return true
+}
+
+// Test decodes every folder of the archive, checking the header, pack stream,
+// folder and file CRCs, and reports the outcome of each, like 7z t. Problems
+// found with the archive are recorded in the report rather than returned, so
+// that every file is tested. An error is only returned if ctx is done.
+func (sz *Reader) Test(ctx context.Context) (*TestReport, error) {
+	report := &TestReport{
+		Files:   make([]FileTestResult, len(sz.File)),
+		Folders: make([]FolderTestResult, len(sz.folders)),
+	}
+
+	if err := sz.testHeader(); err != nil {
+		report.Header, report.HeaderErr = testStatus(err), err
+	}
+
+	files := make([][]int, len(sz.folders))
+	for i, f := range sz.File {
+		report.Files[i].File = f
+		switch {
+		case f.IsEmptyStream:
+		case f.folder < 0:
+			report.Files[i].Status, report.Files[i].Err = TestDecoderError, ErrNotSupported
+		default:
+			files[f.folder] = append(files[f.folder], i)
+		}
+	}
+
+	for i := range sz.folders {
+		report.Folders[i].Folder = i
+		if err := sz.testFolder(ctx, i, files[i], report); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// testHeader rereads the signature header and header, checking their CRCs.
+func (sz *Reader) testHeader() error {
+	signatureHeader, err := headers.ReadSignatureHeader(io.NewSectionReader(sz.r, 0, headers.SignatureHeaderSize))
+	if err != nil {
+		return err
+	}
+
+	crc := crc32.NewIEEE()
+	offset := headers.SignatureHeaderSize + signatureHeader.StartHeader.NextHeaderOffset
+	if _, err = io.Copy(crc, io.NewSectionReader(sz.r, offset, signatureHeader.StartHeader.NextHeaderSize)); err != nil {
+		return err
+	}
+	if crc.Sum32() != signatureHeader.StartHeader.NextHeaderCRC {
+		return &ChecksumError{Expected: signatureHeader.StartHeader.NextHeaderCRC, Actual: crc.Sum32()}
+	}
+	return nil
+}
+
+// testFolder tests the files of a folder, given as indices into sz.File, and
+// records their outcome in the report.
+func (sz *Reader) testFolder(ctx context.Context, folder int, files []int, report *TestReport) error {
+	result := &report.Folders[folder]
+
+	fr, err := sz.folders[folder].reopen()
+	if err != nil {
+		result.Status, result.Err = TestDecoderError, err
+		for _, i := range files {
+			report.Files[i].Status, report.Files[i].Err = TestDecoderError, err
+		}
+		return nil
+	}
+	defer fr.Close()
+
+	crc := crc32.NewIEEE()
+	for n, i := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		f := sz.File[i]
+		err := fr.Next()
+		var size int64
+		if err == nil {
+			size, err = io.Copy(crc, &contextReader{ctx: ctx, r: fr})
+		}
+		if err == nil {
+			continue
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		var packErr *PackChecksumError
+		isPackErr := errors.As(err, &packErr)
+
+		status := testStatus(err)
+		if uint64(size) < f.size && status == TestChecksumMismatch && !isPackErr {
+			// the crc is checked against whatever was read
+			status = TestTruncated
+		}
+		report.Files[i].Status, report.Files[i].Err = status, err
+
+		if status != TestChecksumMismatch || isPackErr {
+			// the folder can't be decoded any further
+			for _, i := range files[n+1:] {
+				report.Files[i].Status, report.Files[i].Err = status, err
+			}
+			result.Status, result.Err = status, err
+			return nil
+		}
+	}
+
+	// finish the folder, so that its last stream is checked
+	if err := fr.Next(); err != nil && err != io.EOF {
+		result.Status, result.Err = testStatus(err), err
+		return nil
+	}
+
+	// the folder's crc covers all of its files
+	if fr.folder.UnpackCRC != 0 && len(files) == len(fr.sizes) {
+		if crc.Sum32() != fr.folder.UnpackCRC {
+			result.Status = TestChecksumMismatch
+			result.Err = &ChecksumError{Expected: fr.folder.UnpackCRC, Actual: crc.Sum32()}
+		}
+	}
+
+	return nil
+}
+
+// testStatus returns the status describing err.
+func testStatus(err error) TestStatus {
+	switch {
+	case errors.Is(err, headers.ErrChecksumMismatch):
+		return TestChecksumMismatch
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return TestTruncated
+	}
+	return TestDecoderError
+}
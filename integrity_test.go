@@ -0,0 +1,110 @@
+package go7z
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/saracen/go7z/headers"
+)
+
+func TestReaderTest(t *testing.T) {
+	f := writeTestArchive(t, testEntries, func(o *WriterOptions) { o.SetMethod(0x00) })
+	size := testArchiveSize(t, f)
+
+	open := func() *Reader {
+		sz, err := NewReader(f, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sz
+	}
+
+	tests := map[string]struct {
+		corrupt func(sz *Reader)
+		status  map[string]TestStatus
+		folder  TestStatus
+	}{
+		"ok": {
+			corrupt: func(sz *Reader) {},
+		},
+		"crc mismatch": {
+			corrupt: func(sz *Reader) { sz.folders[0].crcs[0] ^= 1 },
+			status:  map[string]TestStatus{"dir/hello.txt": TestChecksumMismatch},
+		},
+		"truncated": {
+			corrupt: func(sz *Reader) { sz.folders[0].packs[0].size -= 2 },
+			status:  map[string]TestStatus{"unicode-éè.txt": TestTruncated},
+			folder:  TestTruncated,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sz := open()
+			tc.corrupt(sz)
+
+			report, err := sz.Test(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if report.Header != TestOK {
+				t.Errorf("expected header %v, got %v", TestOK, report.Header)
+			}
+			for _, result := range report.Files {
+				if result.Status != tc.status[result.File.Name] {
+					t.Errorf("%v: expected %v, got %v (%v)", result.File.Name, tc.status[result.File.Name], result.Status, result.Err)
+				}
+			}
+			if report.Folders[0].Status != tc.folder {
+				t.Errorf("expected folder %v, got %v (%v)", tc.folder, report.Folders[0].Status, report.Folders[0].Err)
+			}
+			if report.OK() != (name == "ok") {
+				t.Errorf("expected OK() to be %v", name == "ok")
+			}
+		})
+	}
+}
+
+func TestReaderTestCanceled(t *testing.T) {
+	sz := openTestArchive(t, testEntries, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := sz.Test(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestReaderTestPackChecksum(t *testing.T) {
+	data := packChecksumTestArchive(t)
+	data[headers.SignatureHeaderSize] ^= 1
+
+	sz, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := sz.Test(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// none of the folder's files are decoded once its pack stream fails
+	for _, result := range report.Files {
+		expected := TestChecksumMismatch
+		if result.File.IsEmptyStream {
+			expected = TestOK
+		}
+		if result.Status != expected {
+			t.Errorf("%v: expected %v, got %v (%v)", result.File.Name, expected, result.Status, result.Err)
+		}
+	}
+	var packErr *PackChecksumError
+	if report.Folders[0].Status != TestChecksumMismatch || !errors.As(report.Folders[0].Err, &packErr) {
+		t.Errorf("expected folder pack checksum mismatch, got %v (%v)", report.Folders[0].Status, report.Folders[0].Err)
+	}
+}
@@ -0,0 +1,159 @@
+package go7z
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/saracen/go7z/headers"
+)
+
+var (
+	// ErrHeaderTooLarge is returned when the archive header exceeds
+	// ReaderLimits.MaxHeaderSize.
+	ErrHeaderTooLarge = errors.New("header too large")
+
+	// ErrDictionaryTooLarge is returned when a coder's dictionary or model
+	// memory size exceeds ReaderLimits.MaxDictionarySize.
+	ErrDictionaryTooLarge = errors.New("dictionary too large")
+
+	// ErrUnpackedSizeTooLarge is returned when the total unpacked size of the
+	// archive exceeds ReaderLimits.MaxUnpackedSize.
+	ErrUnpackedSizeTooLarge = errors.New("unpacked size too large")
+
+	// ErrFileTooLarge is returned when the size of a file exceeds
+	// ReaderLimits.MaxFileSize.
+	ErrFileTooLarge = errors.New("file too large")
+
+	// ErrTooManyFiles is returned when the number of files in the archive
+	// exceeds ReaderLimits.MaxFiles.
+	ErrTooManyFiles = errors.New("too many files")
+
+	// ErrCompressionRatioTooHigh is returned when the ratio of a folder's
+	// unpacked size to its packed size exceeds
+	// ReaderLimits.MaxCompressionRatio.
+	ErrCompressionRatioTooHigh = errors.New("compression ratio too high")
+)
+
+// LimitError is returned when an archive exceeds one of the ReaderLimits. Err
+// is the error for the limit exceeded, such as ErrFileTooLarge.
+type LimitError struct {
+	Err   error
+	Value uint64
+	Max   uint64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %d exceeds limit of %d", e.Err, e.Value, e.Max)
+}
+
+// Unwrap returns the error for the limit exceeded.
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// ReaderLimits are limits placed on the archives being read, to guard against
+// archives crafted to use excessive memory or disk space. The limits are
+// checked against the archive header before anything is decompressed. A limit
+// of zero means no limit.
+type ReaderLimits struct {
+	// MaxHeaderSize is the maximum size of the archive header, both as stored
+	// and once decompressed.
+	MaxHeaderSize uint64
+
+	// MaxDictionarySize is the maximum dictionary size of LZMA and LZMA2
+	// coders, the maximum model memory size of PPMd coders and the maximum
+	// window size of Zstandard coders.
+	MaxDictionarySize uint64
+
+	// MaxUnpackedSize is the maximum total size of the archive's contents.
+	MaxUnpackedSize uint64
+
+	// MaxFileSize is the maximum size of any single file.
+	MaxFileSize uint64
+
+	// MaxFiles is the maximum number of files, including directories.
+	MaxFiles int
+
+	// MaxCompressionRatio is the maximum ratio of a folder's unpacked size to
+	// its packed size.
+	MaxCompressionRatio uint64
+}
+
+// SetLimits sets the limits placed on the archive being read.
+func (o *ReaderOptions) SetLimits(limits ReaderLimits) {
+	o.limits = limits
+}
+
+func checkLimit(err error, value, max uint64) error {
+	if max > 0 && value > max {
+		return &LimitError{Err: err, Value: value, Max: max}
+	}
+	return nil
+}
+
+func (l *ReaderLimits) checkHeaderSize(size uint64) error {
+	return checkLimit(ErrHeaderTooLarge, size, l.MaxHeaderSize)
+}
+
+// checkFolder checks the folder's coders and compression ratio.
+func (l *ReaderLimits) checkFolder(folder *headers.Folder, packSize uint64) error {
+	for _, coderInfo := range folder.CoderInfo {
+		if err := checkLimit(ErrDictionaryTooLarge, dictionarySize(coderInfo), l.MaxDictionarySize); err != nil {
+			return err
+		}
+	}
+
+	if l.MaxCompressionRatio > 0 {
+		unpackSize := folder.UnpackSize()
+		if packSize == 0 {
+			packSize = 1
+		}
+		if unpackSize/packSize > l.MaxCompressionRatio {
+			return &LimitError{Err: ErrCompressionRatioTooHigh, Value: unpackSize / packSize, Max: l.MaxCompressionRatio}
+		}
+	}
+
+	return nil
+}
+
+// checkFiles checks the sizes of files. The number of files is checked as the
+// header is read, before the files are allocated.
+func (l *ReaderLimits) checkFiles(files []*File) error {
+	var total uint64
+	for _, f := range files {
+		if err := checkLimit(ErrFileTooLarge, f.size, l.MaxFileSize); err != nil {
+			return err
+		}
+
+		total += f.size
+		if err := checkLimit(ErrUnpackedSizeTooLarge, total, l.MaxUnpackedSize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dictionarySize returns the dictionary size, or model memory size, a coder
+// requires, or zero if unknown.
+func dictionarySize(coderInfo *headers.CoderInfo) uint64 {
+	props := coderInfo.Properties
+
+	switch coderInfo.CodecID {
+	case 0x030101, 0x030401: // lzma, ppmd
+		if len(props) >= 5 {
+			return uint64(binary.LittleEndian.Uint32(props[1:]))
+		}
+
+	case 0x21: // lzma2
+		if len(props) >= 1 {
+			if props[0] > 40 {
+				return 1<<64 - 1
+			}
+			return uint64(2|(props[0]&1)) << (props[0]/2 + 11)
+		}
+	}
+
+	return 0
+}
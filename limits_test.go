@@ -0,0 +1,98 @@
+package go7z
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"testing"
+
+	"github.com/saracen/go7z/headers"
+)
+
+func TestReaderLimits(t *testing.T) {
+	f := writeTestArchive(t, testEntries, nil)
+	size := testArchiveSize(t, f)
+
+	tests := []struct {
+		limits ReaderLimits
+		err    error
+	}{
+		{ReaderLimits{}, nil},
+		{ReaderLimits{MaxHeaderSize: 16}, ErrHeaderTooLarge},
+		{ReaderLimits{MaxDictionarySize: 1024}, ErrDictionaryTooLarge},
+		{ReaderLimits{MaxUnpackedSize: 1024}, ErrUnpackedSizeTooLarge},
+		{ReaderLimits{MaxFileSize: 1024}, ErrFileTooLarge},
+		{ReaderLimits{MaxFiles: 2}, ErrTooManyFiles},
+		{ReaderLimits{MaxCompressionRatio: 2}, ErrCompressionRatioTooHigh},
+		{ReaderLimits{
+			MaxHeaderSize:       1 << 20,
+			MaxDictionarySize:   64 << 20,
+			MaxUnpackedSize:     1 << 30,
+			MaxFileSize:         1 << 30,
+			MaxFiles:            len(testEntries),
+			MaxCompressionRatio: 10000,
+		}, nil},
+	}
+
+	for _, tc := range tests {
+		var opts ReaderOptions
+		opts.SetLimits(tc.limits)
+
+		_, err := NewReaderWithOptions(f, size, opts)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%+v: expected %v, got %v", tc.limits, tc.err, err)
+		}
+
+		var limitErr *LimitError
+		if tc.err != nil && !errors.As(err, &limitErr) {
+			t.Errorf("%+v: expected *LimitError, got %T", tc.limits, err)
+		}
+	}
+}
+
+func TestReaderLimitsEncodedHeader(t *testing.T) {
+	f := writeTestArchive(t, testEntries, func(o *WriterOptions) {
+		o.SetPassword("password")
+		o.SetNumCyclesPower(10)
+		o.SetHeaderEncryption(true)
+	})
+
+	size := testArchiveSize(t, f)
+
+	var opts ReaderOptions
+	opts.SetPassword("password")
+	opts.SetLimits(ReaderLimits{MaxHeaderSize: 128})
+
+	// the stored header is small, but its decompressed size is not
+	if _, err := NewReaderWithOptions(f, size, opts); !errors.Is(err, ErrHeaderTooLarge) {
+		t.Fatalf("expected ErrHeaderTooLarge, got %v", err)
+	}
+}
+
+func TestReaderLimitsFileCount(t *testing.T) {
+	// a header of many files, which is only valid up until their FileInfos
+	// have been allocated
+	header := []byte{0x01, 0x05}
+	header = append(header, make([]byte, 1024)...)
+	header[2] = 0x7f
+
+	var buf bytes.Buffer
+	signatureHeader := &headers.SignatureHeader{}
+	signatureHeader.ArchiveVersion.Minor = 4
+	signatureHeader.StartHeader.NextHeaderSize = int64(len(header))
+	signatureHeader.StartHeader.NextHeaderCRC = crc32.ChecksumIEEE(header)
+	if err := headers.WriteSignatureHeader(&buf, signatureHeader); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(header)
+
+	var opts ReaderOptions
+	opts.SetLimits(ReaderLimits{MaxFiles: 10})
+
+	_, err := NewReaderWithOptions(bytes.NewReader(buf.Bytes()), int64(buf.Len()), opts)
+
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Err != ErrTooManyFiles || limitErr.Value != 0x7f {
+		t.Fatalf("expected too many files error for 127 files, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package go7z
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/saracen/go7z/headers"
+)
+
+// ErrVolumeMissing is returned when the volumes of a multi-volume archive end
+// before the archive does.
+var ErrVolumeMissing = errors.New("volume missing")
+
+// multiReaderAt presents several io.ReaderAts as one contiguous io.ReaderAt.
+type multiReaderAt struct {
+	readers []io.ReaderAt
+	offsets []int64 // offset of each reader, followed by the total size
+}
+
+func newMultiReaderAt(readers []io.ReaderAt, sizes []int64) *multiReaderAt {
+	m := &multiReaderAt{
+		readers: readers,
+		offsets: make([]int64, len(sizes)+1),
+	}
+	for i, size := range sizes {
+		m.offsets[i+1] = m.offsets[i] + size
+	}
+	return m
+}
+
+func (m *multiReaderAt) Size() int64 {
+	return m.offsets[len(m.offsets)-1]
+}
+
+func (m *multiReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	// find the reader containing off
+	i := sort.Search(len(m.readers), func(i int) bool {
+		return m.offsets[i+1] > off
+	})
+
+	var n int
+	for ; len(p) > 0 && i < len(m.readers); i++ {
+		pos := off - m.offsets[i]
+		size := m.offsets[i+1] - m.offsets[i]
+
+		buf := p
+		if remaining := size - pos; int64(len(buf)) > remaining {
+			buf = buf[:remaining]
+		}
+
+		nn, err := m.readers[i].ReadAt(buf, pos)
+		n += nn
+		off += int64(nn)
+		p = p[nn:]
+
+		if err != nil && !(err == io.EOF && nn == len(buf)) {
+			return n, err
+		}
+		if nn < len(buf) {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+
+	if len(p) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// NewMultiReader returns a new Reader reading from a multi-volume archive.
+// The volumes are read in order as one contiguous archive, with each volume
+// assumed to have the size at the same index of sizes.
+func NewMultiReader(volumes []io.ReaderAt, sizes []int64) (*Reader, error) {
+	return NewMultiReaderContext(context.Background(), volumes, sizes, ReaderOptions{})
+}
+
+// NewMultiReaderContext returns a new Reader reading from a multi-volume
+// archive, like NewMultiReader, using the options provided. Reading the
+// archive, including decompression and key derivation, stops with ctx.Err()
+// once ctx is done.
+func NewMultiReaderContext(ctx context.Context, volumes []io.ReaderAt, sizes []int64, opts ReaderOptions) (*Reader, error) {
+	if len(volumes) != len(sizes) {
+		return nil, errors.New("number of volumes and sizes differ")
+	}
+
+	r := newMultiReaderAt(volumes, sizes)
+	return NewReaderContext(ctx, r, r.Size(), opts)
+}
+
+// OpenMultiVolumeReader will open a multi-volume 7z archive and return a
+// ReadCloser. name is the first volume, such as "archive.7z.001", and the
+// following volumes are found by incrementing its numeric extension. If name
+// has no numeric extension, it's opened as a single volume.
+func OpenMultiVolumeReader(name string) (*ReadCloser, error) {
+	return OpenMultiVolumeReaderContext(context.Background(), name, ReaderOptions{})
+}
+
+// OpenMultiVolumeReaderContext will open a multi-volume 7z archive, like
+// OpenMultiVolumeReader, using the options provided. Options such as the
+// password need to be provided this way when the archive header is
+// encrypted. Reading the archive stops with ctx.Err() once ctx is done.
+func OpenMultiVolumeReaderContext(ctx context.Context, name string, opts ReaderOptions) (*ReadCloser, error) {
+	var files []*os.File
+	var volumes []io.ReaderAt
+	var sizes []int64
+
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	volume := name
+	for volume != "" {
+		f, err := os.Open(volume)
+		if err != nil {
+			if os.IsNotExist(err) && len(files) > 0 {
+				break
+			}
+			closeAll()
+			return nil, err
+		}
+		files = append(files, f)
+
+		fi, err := f.Stat()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		volumes = append(volumes, f)
+		sizes = append(sizes, fi.Size())
+
+		volume = nextVolumeName(volume)
+	}
+
+	r := newMultiReaderAt(volumes, sizes)
+
+	// check that the archive doesn't extend past the volumes found
+	signatureHeader, err := headers.ReadSignatureHeader(io.NewSectionReader(r, 0, r.Size()))
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	end := headers.SignatureHeaderSize + signatureHeader.StartHeader.NextHeaderOffset + signatureHeader.StartHeader.NextHeaderSize
+	if end > r.Size() && volume != "" {
+		closeAll()
+		return nil, fmt.Errorf("%s: %w", volume, ErrVolumeMissing)
+	}
+
+	rc := new(ReadCloser)
+	rc.Options = opts
+	rc.Options.ctx = ctx
+	if err := rc.init(r, r.Size(), false); err != nil {
+		closeAll()
+		return nil, err
+	}
+	rc.files = files
+
+	return rc, nil
+}
+
+// nextVolumeName returns the name of the volume following name, by
+// incrementing its numeric extension, or an empty string if it has none.
+func nextVolumeName(name string) string {
+	ext := filepath.Ext(name)
+	if len(ext) < 2 {
+		return ""
+	}
+
+	n, err := strconv.Atoi(ext[1:])
+	if err != nil || strings.TrimLeft(ext[1:], "0123456789") != "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s.%0*d", strings.TrimSuffix(name, ext), len(ext)-1, n+1)
+}
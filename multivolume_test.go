@@ -0,0 +1,158 @@
+package go7z
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func splitTestArchive(t *testing.T, dir string, volumeSize int, opts func(*WriterOptions)) []string {
+	f := writeTestArchive(t, testEntries, opts)
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for i := 0; len(data) > 0; i++ {
+		n := volumeSize
+		if n > len(data) {
+			n = len(data)
+		}
+
+		name := filepath.Join(dir, fmt.Sprintf("test.7z.%03d", i+1))
+		if err := ioutil.WriteFile(name, data[:n], 0644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+		data = data[n:]
+	}
+
+	return names
+}
+
+func TestOpenMultiVolumeReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := splitTestArchive(t, dir, 128, nil)
+	if len(names) < 3 {
+		t.Fatalf("expected at least 3 volumes, got %d", len(names))
+	}
+
+	sz, err := OpenMultiVolumeReader(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sz.Close()
+
+	for _, entry := range testEntries {
+		hdr, err := sz.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != entry.Name {
+			t.Fatalf("expected name %q, got %q", entry.Name, hdr.Name)
+		}
+
+		contents, err := ioutil.ReadAll(sz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, entry.Contents) {
+			t.Fatalf("%v: contents mismatch", entry.Name)
+		}
+	}
+	if _, err := sz.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestOpenMultiVolumeReaderMissingVolume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := splitTestArchive(t, dir, 128, nil)
+	if err := os.Remove(names[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenMultiVolumeReader(names[0])
+	if !errors.Is(err, ErrVolumeMissing) {
+		t.Fatalf("expected ErrVolumeMissing, got %v", err)
+	}
+	if err.Error() != names[1]+": volume missing" {
+		t.Fatalf("expected error naming %v, got %v", names[1], err)
+	}
+}
+
+func TestOpenMultiVolumeReaderContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := splitTestArchive(t, dir, 128, func(o *WriterOptions) {
+		o.SetPassword("password")
+		o.SetNumCyclesPower(10)
+		o.SetHeaderEncryption(true)
+	})
+
+	// the encrypted header can't be read without a password
+	if _, err = OpenMultiVolumeReader(names[0]); err == nil {
+		t.Fatal("expected error opening encrypted header without a password")
+	}
+
+	var opts ReaderOptions
+	opts.SetPassword("password")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = OpenMultiVolumeReaderContext(ctx, names[0], opts); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	limited := opts
+	limited.SetLimits(ReaderLimits{MaxFiles: 1})
+	if _, err = OpenMultiVolumeReaderContext(context.Background(), names[0], limited); !errors.Is(err, ErrTooManyFiles) {
+		t.Fatalf("expected ErrTooManyFiles, got %v", err)
+	}
+
+	sz, err := OpenMultiVolumeReaderContext(context.Background(), names[0], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sz.Close()
+
+	for _, entry := range testEntries {
+		hdr, err := sz.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != entry.Name {
+			t.Fatalf("expected name %q, got %q", entry.Name, hdr.Name)
+		}
+
+		contents, err := ioutil.ReadAll(sz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, entry.Contents) {
+			t.Fatalf("%v: contents mismatch", entry.Name)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package go7z
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"hash"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"sync"
 
@@ -36,13 +40,100 @@ type Reader struct {
 
 	folders []*folderReader
 
+	// File holds the archive's files, in the order they appear in the
+	// archive header.
+	File []*File
+
+	fsOnce    sync.Once
+	fsEntries map[string]*fsEntry
+
 	Options ReaderOptions
 }
 
+// File is a file in a 7z archive.
+type File struct {
+	*headers.FileInfo
+
+	sz     *Reader
+	folder int // -1 if the file has no contents
+	index  int
+	size   uint64
+}
+
+// Size returns the uncompressed size of the file.
+func (f *File) Size() uint64 {
+	return f.size
+}
+
+// FolderIndex returns the index into Reader.Folders of the folder holding the
+// file's contents, or -1 if the file has no contents.
+func (f *File) FolderIndex() int {
+	return f.folder
+}
+
+// Folder is a block of one or more files compressed together, known as a
+// solid block.
+type Folder struct {
+	*headers.Folder
+
+	// PackSizes holds the size of each of the folder's packed streams.
+	PackSizes []uint64
+
+	// Files holds the files stored in the folder, in order.
+	Files []*File
+}
+
+// PackedSize returns the total size of the folder's packed streams.
+func (f *Folder) PackedSize() uint64 {
+	var size uint64
+	for _, s := range f.PackSizes {
+		size += s
+	}
+	return size
+}
+
+// Open returns an io.ReadCloser that provides access to the file's contents.
+// Only the folder holding the file is decompressed, and only up to the end of
+// the file. Multiple files may be read concurrently.
+func (f *File) Open() (io.ReadCloser, error) {
+	if f.IsEmptyStream {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if f.folder < 0 {
+		return nil, ErrNotSupported
+	}
+
+	fr, err := f.sz.folders[f.folder].reopen()
+	if err != nil {
+		return nil, err
+	}
+	if err = fr.skipTo(f.index); err != nil {
+		fr.Close()
+		return nil, err
+	}
+
+	return &fileReader{fr: fr}, nil
+}
+
+type fileReader struct {
+	fr *folderReader
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	return r.fr.Read(p)
+}
+
+func (r *fileReader) Close() error {
+	return r.fr.Close()
+}
+
 // ReaderOptions are optional options to configure a 7z archive reader.
 type ReaderOptions struct {
 	password string
-	cb       func() string
+	prompt   *passwordPrompt
+
+	ctx    context.Context
+	limits ReaderLimits
 }
 
 // SetPassword sets the password used for extraction.
@@ -53,35 +144,78 @@ func (o *ReaderOptions) SetPassword(password string) {
 // SetPasswordCallback sets the callback thats used if a password is required,
 // but wasn't supplied with SetPassword()
 func (o *ReaderOptions) SetPasswordCallback(cb func() string) {
-	o.cb = cb
+	o.prompt = &passwordPrompt{cb: cb}
 }
 
 // Password returns the set password. This will call the password callback
-// supplied to SetPasswordCallback() if no password is set.
+// supplied to SetPasswordCallback() if no password is set. The callback is
+// only called once, even when folders are decompressed concurrently.
 func (o *ReaderOptions) Password() string {
-	if o.password != "" {
+	if o.password != "" || o.prompt == nil {
 		return o.password
 	}
-	if o.cb != nil {
-		o.password = o.cb()
+	return o.prompt.password()
+}
+
+// passwordPrompt calls a password callback once, and remembers its result.
+// It's shared by copies of the ReaderOptions it was set on.
+type passwordPrompt struct {
+	once sync.Once
+	cb   func() string
+	pw   string
+}
+
+func (p *passwordPrompt) password() string {
+	p.once.Do(func() {
+		p.pw = p.cb()
+	})
+	return p.pw
+}
+
+// Context returns the context the archive is being read with. Decompressors
+// should stop any long running work once it is done.
+func (o *ReaderOptions) Context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
 	}
-	return o.password
+	return o.ctx
 }
 
 // ReadCloser provides an io.ReadCloser for the archive when opened with
-// OpenReader.
+// OpenReader or OpenMultiVolumeReader.
 type ReadCloser struct {
-	f *os.File
+	files []*os.File
 	Reader
 }
 
-// Close closes the 7z file, rendering it unusable for I/O.
+// Close closes the 7z file, or all of its volumes, rendering it unusable for
+// I/O.
 func (rc *ReadCloser) Close() error {
-	return rc.f.Close()
+	var err error
+	for _, f := range rc.files {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
 
 // OpenReader will open the 7z file specified by name and return a ReadCloser.
 func OpenReader(name string) (*ReadCloser, error) {
+	return OpenReaderWithOptions(name, ReaderOptions{})
+}
+
+// OpenReaderWithOptions will open the 7z file specified by name, using the
+// options provided, and return a ReadCloser. Options such as the password
+// need to be provided this way when the archive header is encrypted.
+func OpenReaderWithOptions(name string, opts ReaderOptions) (*ReadCloser, error) {
+	return OpenReaderContext(context.Background(), name, opts)
+}
+
+// OpenReaderContext will open the 7z file specified by name, using the options
+// provided, and return a ReadCloser. Reading the archive, including
+// decompression and key derivation, stops with ctx.Err() once ctx is done.
+func OpenReaderContext(ctx context.Context, name string, opts ReaderOptions) (*ReadCloser, error) {
 	f, err := os.Open(name)
 	if err != nil {
 		return nil, err
@@ -94,11 +228,13 @@ func OpenReader(name string) (*ReadCloser, error) {
 	}
 
 	r := new(ReadCloser)
+	r.Options = opts
+	r.Options.ctx = ctx
 	if err := r.init(f, fi.Size(), false); err != nil {
 		f.Close()
 		return nil, err
 	}
-	r.f = f
+	r.files = []*os.File{f}
 
 	return r, nil
 }
@@ -106,7 +242,25 @@ func OpenReader(name string) (*ReadCloser, error) {
 // NewReader returns a new Reader reading from r, which is assumed to
 // have the given size in bytes.
 func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	return NewReaderWithOptions(r, size, ReaderOptions{})
+}
+
+// NewReaderWithOptions returns a new Reader reading from r, which is assumed
+// to have the given size in bytes, using the options provided. Options such as
+// the password need to be provided this way when the archive header is
+// encrypted.
+func NewReaderWithOptions(r io.ReaderAt, size int64, opts ReaderOptions) (*Reader, error) {
+	return NewReaderContext(context.Background(), r, size, opts)
+}
+
+// NewReaderContext returns a new Reader reading from r, which is assumed to
+// have the given size in bytes, using the options provided. Reading the
+// archive, including decompression and key derivation, stops with ctx.Err()
+// once ctx is done.
+func NewReaderContext(ctx context.Context, r io.ReaderAt, size int64, opts ReaderOptions) (*Reader, error) {
 	szr := new(Reader)
+	szr.Options = opts
+	szr.Options.ctx = ctx
 	if err := szr.init(r, size, false); err != nil {
 		return nil, err
 	}
@@ -128,49 +282,188 @@ func (sz *Reader) init(r io.ReaderAt, size int64, ignoreChecksumError bool) erro
 	if signatureHeader.StartHeader.NextHeaderSize > size-headers.SignatureHeaderSize {
 		return io.ErrUnexpectedEOF
 	}
+	if err := sz.Options.limits.checkHeaderSize(uint64(signatureHeader.StartHeader.NextHeaderSize)); err != nil {
+		return err
+	}
 
 	crc := crc32.NewIEEE()
 	tee := io.TeeReader(bufio.NewReader(io.LimitReader(sz.r, signatureHeader.StartHeader.NextHeaderSize)), crc)
 
-	header, encoded, err := headers.ReadPackedStreamsForHeaders(&io.LimitedReader{tee, signatureHeader.StartHeader.NextHeaderSize})
+	header, encoded, err := sz.readHeader(tee, signatureHeader.StartHeader.NextHeaderSize)
 	if err != nil {
 		return err
 	}
 	if crc.Sum32() != signatureHeader.StartHeader.NextHeaderCRC {
 		if !ignoreChecksumError {
-			return headers.ErrChecksumMismatch
+			return &ChecksumError{Expected: signatureHeader.StartHeader.NextHeaderCRC, Actual: crc.Sum32()}
 		}
 	}
 
 	if encoded != nil {
-		folders, err := sz.extract(encoded)
+		data, err := sz.decodeStreams(encoded)
 		if err != nil {
 			return err
 		}
-		if len(folders) != 1 {
+		if len(data) != 1 {
 			return ErrNotSupported
 		}
-		if err = folders[0].Next(); err != nil {
+
+		header, _, err = sz.readHeader(bytes.NewReader(data[0]), int64(len(data[0])))
+		if err != nil {
 			return err
 		}
+	}
 
-		header, _, err = headers.ReadPackedStreamsForHeaders(&io.LimitedReader{folders[0].sb, folders[0].sb.Size()})
+	if header == nil {
+		return ErrNotSupported
+	}
+	sz.header = header
+
+	// archives containing only empty files and directories have no streams
+	if sz.header.MainStreamsInfo != nil {
+		sz.folders, err = sz.extract(sz.header.MainStreamsInfo)
 		if err != nil {
 			return err
 		}
+	}
 
-		if err = folders[0].Next(); err != io.EOF {
-			return ErrNotSupported
+	sz.initFiles()
+
+	return sz.Options.limits.checkFiles(sz.File)
+}
+
+// readHeader reads a header, or encoded header, of the size given. Errors
+// parsing the header are returned as a HeaderError, except for io.EOF, which
+// is returned as is for an empty archive.
+func (sz *Reader) readHeader(r io.Reader, size int64) (*headers.Header, *headers.StreamsInfo, error) {
+	var decodeErr error
+	decode := func(streamsInfo *headers.StreamsInfo) ([][]byte, error) {
+		data, err := sz.decodeStreams(streamsInfo)
+		decodeErr = err
+		return data, err
+	}
+
+	// the number of files is limited before their FileInfos are allocated
+	maxFiles := sz.Options.limits.MaxFiles
+
+	lr := &io.LimitedReader{R: r, N: size}
+	header, encoded, err := headers.ReadPackedStreamsForHeadersWithDecoder(lr, decode, maxFiles)
+	if err != nil {
+		if err == decodeErr || err == io.EOF {
+			return nil, nil, err
 		}
+
+		var cerr *headers.FileCountError
+		if errors.As(err, &cerr) && maxFiles > 0 && cerr.Count > maxFiles {
+			return nil, nil, &LimitError{Err: ErrTooManyFiles, Value: uint64(cerr.Count), Max: uint64(maxFiles)}
+		}
+
+		herr := &HeaderError{Offset: size - lr.N, Err: err}
+		var perr *headers.UnexpectedPropertyIDError
+		if errors.As(err, &perr) {
+			herr.PropertyID = perr.PropertyID
+		}
+		return nil, nil, herr
 	}
+	return header, encoded, nil
+}
 
-	if header == nil {
-		return ErrNotSupported
+// decodeStreams returns the unpacked contents of each folder of streams that
+// are part of the header, such as an encoded header or additional streams.
+func (sz *Reader) decodeStreams(streamsInfo *headers.StreamsInfo) ([][]byte, error) {
+	folders, err := sz.extract(streamsInfo)
+	if err != nil {
+		return nil, err
 	}
-	sz.header = header
-	sz.folders, err = sz.extract(sz.header.MainStreamsInfo)
 
-	return err
+	data := make([][]byte, len(folders))
+	for i, fr := range folders {
+		if err := sz.Options.limits.checkHeaderSize(fr.folder.UnpackSize()); err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		for {
+			err := fr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err == nil {
+				_, err = buf.ReadFrom(fr)
+			}
+			if err != nil {
+				fr.Close()
+				return nil, err
+			}
+		}
+		fr.Close()
+
+		data[i] = buf.Bytes()
+	}
+
+	return data, nil
+}
+
+// initFiles records which folder, and which stream within that folder, holds
+// the contents of each file.
+func (sz *Reader) initFiles() {
+	sz.File = make([]*File, len(sz.header.FilesInfo))
+
+	folder, index := 0, 0
+	for i, fileInfo := range sz.header.FilesInfo {
+		f := &File{FileInfo: fileInfo, sz: sz, folder: -1}
+		sz.File[i] = f
+
+		if fileInfo.IsEmptyStream {
+			continue
+		}
+
+		for folder < len(sz.folders) && index >= len(sz.folders[folder].sizes) {
+			folder++
+			index = 0
+		}
+		if folder >= len(sz.folders) {
+			continue
+		}
+
+		f.folder = folder
+		f.index = index
+		f.size = sz.folders[folder].sizes[index]
+		if sz.folders[folder].files == nil {
+			sz.folders[folder].files = make([]*File, len(sz.folders[folder].sizes))
+		}
+		sz.folders[folder].files[index] = f
+		index++
+	}
+}
+
+// Comment returns the archive's comment.
+func (sz *Reader) Comment() string {
+	return sz.header.Comment
+}
+
+// Properties returns the archive's properties, other than its comment, keyed
+// by property type.
+func (sz *Reader) Properties() map[byte][]byte {
+	return sz.header.Properties
+}
+
+// Folders returns the archive's folders, in the order they're stored.
+func (sz *Reader) Folders() []*Folder {
+	folders := make([]*Folder, len(sz.folders))
+	for i, fr := range sz.folders {
+		folder := &Folder{Folder: fr.folder}
+		for _, pack := range fr.packs {
+			folder.PackSizes = append(folder.PackSizes, uint64(pack.size))
+		}
+		for _, f := range fr.files {
+			if f != nil {
+				folder.Files = append(folder.Files, f)
+			}
+		}
+		folders[i] = folder
+	}
+	return folders
 }
 
 // Next advances to the next entry in the 7z archive.
@@ -214,64 +507,57 @@ func (sz *Reader) extract(streamsInfo *headers.StreamsInfo) ([]*folderReader, er
 			folder.PackedIndices = []int{0}
 		}
 
-		fr := &folderReader{}
-		fr.inputs = make(map[int]io.Reader)
-		fr.binder = solidblock.Binder{}
-
-		// setup codecs
-		for j := range folder.CoderInfo {
-			coderInfo := folder.CoderInfo[j]
-			size := folder.UnpackSizes[j]
-
-			d := decompressor(coderInfo.CodecID)
-			if d == nil {
-				return folders, ErrDecompressorNotFound
-			}
-
-			fn := func(in []io.Reader) ([]io.Reader, error) {
-				r, err := d(in, coderInfo.Properties, size, &sz.Options)
-
-				return []io.Reader{r}, err
-			}
-
-			fr.binder.AddCodec(fn, coderInfo.NumInStreams, coderInfo.NumOutStreams)
-		}
-
 		// setup initial inputs
+		var packs []packStream
+		var packSize uint64
 		for index, input := range folder.PackedIndices {
 			if packedIndicesOffset+index >= len(streamsInfo.PackInfo.PackSizes) {
-				return nil, fmt.Errorf("folder references invalid packinfo")
+				return nil, &HeaderError{Offset: -1, Err: fmt.Errorf("folder %d references invalid packinfo", i)}
+			}
+
+			packIndex := packedIndicesOffset + index
+			size := int64(streamsInfo.PackInfo.PackSizes[packIndex])
+
+			var crc uint32
+			if packIndex < len(streamsInfo.PackInfo.Digests) {
+				crc = streamsInfo.PackInfo.Digests[packIndex]
 			}
 
-			size := int64(streamsInfo.PackInfo.PackSizes[packedIndicesOffset+index])
-			fr.inputs[input] = io.NewSectionReader(sz.r, offset, size)
+			packs = append(packs, packStream{input: input, index: packIndex, offset: offset, size: size, crc: crc})
 			offset += size
+			packSize += uint64(size)
 		}
 		packedIndicesOffset += len(folder.PackedIndices)
 
-		// setup pairs
-		for _, bindPairsInfo := range folder.BindPairsInfo {
-			fr.binder.Pair(bindPairsInfo.InIndex, bindPairsInfo.OutIndex)
+		if err := sz.Options.limits.checkFolder(folder, packSize); err != nil {
+			return folders, err
 		}
 
+		var folderSizes []uint64
+		var folderCRCs []uint32
 		if streamsInfo.SubStreamsInfo != nil {
 			numUnpackStreamsInFolders := streamsInfo.SubStreamsInfo.NumUnpackStreamsInFolders
 			if i >= len(numUnpackStreamsInFolders) {
-				return nil, fmt.Errorf("folder references invalid unpack stream")
+				return nil, &HeaderError{Offset: -1, Err: fmt.Errorf("folder %d references invalid unpack stream", i)}
 			}
 
 			off := numUnpackStreamsInFolders[i]
 			if off > len(sizes) || off > len(crcs) {
-				return nil, fmt.Errorf("folder references invalid unpack size or digest")
+				return nil, &HeaderError{Offset: -1, Err: fmt.Errorf("folder %d references invalid unpack size or digest", i)}
 			}
 
-			fr.sizes = sizes[:off]
-			fr.crcs = crcs[:off]
-			sizes = sizes[len(fr.sizes):]
-			crcs = crcs[len(fr.crcs):]
+			folderSizes = sizes[:off]
+			folderCRCs = crcs[:off]
+			sizes = sizes[len(folderSizes):]
+			crcs = crcs[len(folderCRCs):]
 		} else {
-			fr.sizes = []uint64{folder.UnpackSize()}
-			fr.crcs = []uint32{folder.UnpackCRC}
+			folderSizes = []uint64{folder.UnpackSize()}
+			folderCRCs = []uint32{folder.UnpackCRC}
+		}
+
+		fr, err := sz.newFolderReader(folder, packs, folderSizes, folderCRCs)
+		if err != nil {
+			return folders, err
 		}
 
 		folders = append(folders, fr)
@@ -280,16 +566,140 @@ func (sz *Reader) extract(streamsInfo *headers.StreamsInfo) ([]*folderReader, er
 	return folders, nil
 }
 
+// packStream is a packed stream used as one of a folder's inputs.
+type packStream struct {
+	input  int
+	index  int
+	offset int64
+	size   int64
+	crc    uint32
+}
+
+// packReader reads a packed stream, checking it against its CRC, if it has
+// one, as it is read.
+type packReader struct {
+	ra   io.ReaderAt
+	r    *io.SectionReader
+	pack packStream
+	crc  uint32
+}
+
+func newPackReader(r io.ReaderAt, pack packStream) *packReader {
+	return &packReader{ra: r, r: io.NewSectionReader(r, pack.offset, pack.size), pack: pack}
+}
+
+// Read reads from the packed stream, returning a PackChecksumError instead of
+// io.EOF if it doesn't match its CRC.
+func (pr *packReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.crc = crc32.Update(pr.crc, crc32.IEEETable, p[:n])
+	if err == io.EOF && pr.pack.crc != 0 && pr.crc != pr.pack.crc {
+		return n, &PackChecksumError{Index: pr.pack.index}
+	}
+	return n, err
+}
+
+// verify checks the whole packed stream against its CRC, reading whatever
+// hasn't been read yet without consuming it. It's used to find whether an
+// error decoding a folder was caused by corrupt packed data.
+func (pr *packReader) verify(ctx context.Context) error {
+	if pr.pack.crc == 0 {
+		return nil
+	}
+
+	offset, err := pr.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	rest := &contextReader{ctx: ctx, r: io.NewSectionReader(pr.ra, pr.pack.offset+offset, pr.pack.size-offset)}
+	crc := pr.crc
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := rest.Read(buf)
+		crc = crc32.Update(crc, crc32.IEEETable, buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if crc != pr.pack.crc {
+		return &PackChecksumError{Index: pr.pack.index}
+	}
+	return nil
+}
+
 type folderReader struct {
+	sz     *Reader
+	folder *headers.Folder
+	packs  []packStream
+
 	binder solidblock.Binder
 	sizes  []uint64
 	crcs   []uint32
+	files  []*File // the file of each stream, or nil
+
+	bufs  []*bufio.Reader
+	packr []*packReader
 
-	inputs map[int]io.Reader
+	out     io.Reader
+	stream  *io.LimitedReader
+	checked bool // whether the stream's crc has been checked
+	index   int
+	crc     hash.Hash32
+}
+
+func (sz *Reader) newFolderReader(folder *headers.Folder, packs []packStream, sizes []uint64, crcs []uint32) (*folderReader, error) {
+	fr := &folderReader{
+		sz:     sz,
+		folder: folder,
+		packs:  packs,
+		sizes:  sizes,
+		crcs:   crcs,
+	}
+
+	// setup codecs
+	for j := range folder.CoderInfo {
+		coderInfo := folder.CoderInfo[j]
+		size := folder.UnpackSizes[j]
+
+		d := decompressor(coderInfo.CodecID)
+		if d == nil {
+			return nil, &UnsupportedCodecError{CodecID: coderInfo.CodecID}
+		}
+
+		fn := func(in []io.Reader) ([]io.Reader, error) {
+			r, err := d(in, coderInfo.Properties, size, &sz.Options)
+			if err != nil {
+				return nil, err
+			}
+
+			return []io.Reader{&contextReader{ctx: sz.Options.Context(), r: r}}, nil
+		}
+
+		fr.binder.AddCodec(fn, coderInfo.NumInStreams, coderInfo.NumOutStreams)
+	}
+
+	// setup pairs
+	for _, bindPairsInfo := range folder.BindPairsInfo {
+		fr.binder.Pair(bindPairsInfo.InIndex, bindPairsInfo.OutIndex)
+	}
 
-	bufs []*bufio.Reader
+	return fr, nil
+}
 
-	sb *solidblock.Solidblock
+// reopen returns a new folderReader for the same folder, positioned at its
+// start.
+func (fr *folderReader) reopen() (*folderReader, error) {
+	r, err := fr.sz.newFolderReader(fr.folder, fr.packs, fr.sizes, fr.crcs)
+	if err != nil {
+		return nil, err
+	}
+	r.files = fr.files
+	return r, nil
 }
 
 var bufioReaderPool = sync.Pool{
@@ -298,16 +708,22 @@ var bufioReaderPool = sync.Pool{
 	},
 }
 
+// Next advances to the folder's next stream. The rest of the current stream
+// is decompressed and checked against its CRC first, so that a mismatch is
+// reported for the stream it belongs to.
 func (fr *folderReader) Next() error {
-	if fr.sb == nil {
+	if fr.out == nil {
+		fr.bufs = make([]*bufio.Reader, 0, len(fr.packs))
+		fr.packr = make([]*packReader, 0, len(fr.packs))
+		for _, pack := range fr.packs {
+			pr := newPackReader(fr.sz.r, pack)
+			fr.packr = append(fr.packr, pr)
 
-		fr.bufs = make([]*bufio.Reader, 0, len(fr.inputs))
-		for in, r := range fr.inputs {
 			br := bufioReaderPool.Get().(*bufio.Reader)
-			br.Reset(r)
+			br.Reset(pr)
 			fr.bufs = append(fr.bufs, br)
 
-			fr.binder.Reader(br, in)
+			fr.binder.Reader(&contextReader{ctx: fr.sz.Options.Context(), r: br}, pack.input)
 		}
 
 		outputs, err := fr.binder.Outputs()
@@ -321,10 +737,92 @@ func (fr *folderReader) Next() error {
 			return ErrNotSupported
 		}
 
-		fr.sb = solidblock.New(outputs[0], fr.sizes, fr.crcs)
+		fr.out = outputs[0]
+		fr.index = -1
+		fr.crc = crc32.NewIEEE()
+	}
+
+	if fr.stream != nil && !fr.checked {
+		if _, err := io.Copy(ioutil.Discard, fr); err != nil {
+			return err
+		}
+	}
+
+	if fr.index+1 >= len(fr.sizes) {
+		if fr.stream != nil {
+			// packed data left unread by the decoders is still checked
+			if err := fr.verifyPacks(); err != nil {
+				return err
+			}
+		}
+		fr.stream = nil
+		return io.EOF
+	}
+
+	fr.index++
+	fr.crc.Reset()
+	fr.stream = &io.LimitedReader{R: fr.out, N: int64(fr.sizes[fr.index])}
+	fr.checked = false
+	return nil
+}
+
+// Read reads from the folder's current stream, checking it against its CRC
+// once fully read. Streams with an undefined CRC of zero aren't checked.
+func (fr *folderReader) Read(p []byte) (int, error) {
+	if fr.stream == nil {
+		return 0, io.EOF
+	}
+
+	n, err := fr.read(p)
+	if err != nil && err != io.EOF && fr.sz.Options.Context().Err() == nil {
+		// errors caused by corrupt packed data are reported as such
+		if perr := fr.verifyPacks(); perr != nil {
+			return n, perr
+		}
+	}
+	return n, err
+}
+
+func (fr *folderReader) read(p []byte) (int, error) {
+	n, err := fr.stream.Read(p)
+	fr.crc.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+	if fr.stream.N > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+
+	fr.checked = true
+	if expected := fr.crcs[fr.index]; expected != 0 && fr.crc.Sum32() != expected {
+		var f *File
+		if fr.index < len(fr.files) {
+			f = fr.files[fr.index]
+		}
+		return n, &ChecksumError{File: f, Expected: expected, Actual: fr.crc.Sum32()}
+	}
+	return n, io.EOF
+}
+
+// verifyPacks checks each of the folder's packed streams against its CRC.
+func (fr *folderReader) verifyPacks() error {
+	for _, pr := range fr.packr {
+		if err := pr.verify(fr.sz.Options.Context()); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	return fr.sb.Next()
+// skipTo advances the folder to the stream at index, decompressing and
+// discarding the contents of any streams before it.
+func (fr *folderReader) skipTo(index int) error {
+	for i := 0; i <= index; i++ {
+		if err := fr.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (fr *folderReader) Close() error {
@@ -332,12 +830,23 @@ func (fr *folderReader) Close() error {
 		bufioReaderPool.Put(buf)
 	}
 	fr.bufs = nil
+	fr.packr = nil
 	return nil
 }
 
 func (sz *Reader) next() (*headers.FileInfo, error) {
+	if err := sz.Options.Context().Err(); err != nil {
+		return nil, err
+	}
+
 	fileInfo := sz.nextFileInfo()
 	if fileInfo == nil {
+		// finish the last folder, so that its last stream is checked
+		if sz.folderIndex < len(sz.folders) {
+			if err := sz.folders[sz.folderIndex].Next(); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
 		return nil, io.EOF
 	}
 
@@ -346,13 +855,21 @@ func (sz *Reader) next() (*headers.FileInfo, error) {
 		return fileInfo, nil
 	}
 
-	if sz.folders[sz.folderIndex].Next() == io.EOF {
+	if sz.folderIndex >= len(sz.folders) {
+		return nil, ErrNotSupported
+	}
+
+	err := sz.folders[sz.folderIndex].Next()
+	if err == io.EOF {
 		sz.folders[sz.folderIndex].Close()
 		sz.folderIndex++
 		if sz.folderIndex >= len(sz.folders) {
 			return nil, io.EOF
 		}
-		sz.folders[sz.folderIndex].Next()
+		err = sz.folders[sz.folderIndex].Next()
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	return fileInfo, nil
@@ -369,9 +886,22 @@ func (sz *Reader) Read(p []byte) (int, error) {
 		return 0, io.EOF
 	}
 
-	n, err := sz.folders[sz.folderIndex].sb.Read(p)
+	n, err := sz.folders[sz.folderIndex].Read(p)
 	if err != nil && err != io.EOF {
 		sz.err = err
 	}
 	return n, err
 }
+
+// contextReader stops reading once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
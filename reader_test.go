@@ -1,11 +1,19 @@
 package go7z
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/saracen/go7z-fixtures"
+	"github.com/saracen/go7z/filters"
+	"github.com/saracen/go7z/headers"
 )
 
 func TestOpenReader(t *testing.T) {
@@ -45,7 +53,7 @@ func TestOpenReader(t *testing.T) {
 }
 
 func TestReader(t *testing.T) {
-	fs, closeall := fixtures.Fixtures([]string{"executable", "random"}, []string{"ppmd", "ppc", "arm"})
+	fs, closeall := fixtures.Fixtures([]string{"executable", "random"}, nil)
 	defer closeall.Close()
 
 	for _, f := range fs {
@@ -75,3 +83,259 @@ func TestReader(t *testing.T) {
 		}
 	}
 }
+
+func TestReaderFileOpen(t *testing.T) {
+	sz := openTestArchive(t, testEntries, nil)
+
+	if len(sz.File) != len(testEntries) {
+		t.Fatalf("expected %d files, got %d", len(testEntries), len(sz.File))
+	}
+
+	// open files in reverse order, so that each file has to be located
+	for i := len(sz.File) - 1; i >= 0; i-- {
+		file := sz.File[i]
+		if file.Name != testEntries[i].Name {
+			t.Fatalf("expected name %q, got %q", testEntries[i].Name, file.Name)
+		}
+		if file.Size() != uint64(len(testEntries[i].Contents)) {
+			t.Fatalf("%v: expected size %d, got %d", file.Name, len(testEntries[i].Contents), file.Size())
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, testEntries[i].Contents) {
+			t.Fatalf("%v: contents mismatch", file.Name)
+		}
+	}
+}
+
+func TestReaderAESInvalidPower(t *testing.T) {
+	sz := openTestArchive(t, testEntries, func(o *WriterOptions) {
+		o.SetPassword("password")
+		o.SetNumCyclesPower(10)
+	})
+
+	// the power is checked before any key derivation cycles
+	coderInfo := sz.folders[0].folder.CoderInfo[0]
+	coderInfo.Properties[0] = 0xc0 | 40
+
+	if _, err := sz.File[1].Open(); !errors.Is(err, filters.ErrAESInvalidPower) {
+		t.Fatalf("expected filters.ErrAESInvalidPower, got %v", err)
+	}
+}
+
+func TestReaderContextCanceled(t *testing.T) {
+	f := writeTestArchive(t, testEntries, func(o *WriterOptions) {
+		o.SetPassword("password")
+		o.SetNumCyclesPower(10)
+		o.SetHeaderEncryption(true)
+	})
+
+	size := testArchiveSize(t, f)
+
+	var opts ReaderOptions
+	opts.SetPassword("password")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the encrypted header can't be read once canceled
+	if _, err := NewReaderContext(ctx, f, size, opts); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// cancel whilst reading contents
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	sz, err := NewReaderContext(ctx, f, size, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		hdr, err := sz.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name == "random.bin" {
+			break
+		}
+	}
+
+	var buf [1024]byte
+	if _, err = sz.Read(buf[:]); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err = io.Copy(ioutil.Discard, sz); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// packChecksumTestArchive returns a test archive stored with copy that has
+// CRCs recorded for its packed streams, which Writer doesn't write.
+func packChecksumTestArchive(t *testing.T) []byte {
+	f := writeTestArchive(t, testEntries, func(o *WriterOptions) { o.SetMethod(0x00) })
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signatureHeader, err := headers.ReadSignatureHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := headers.SignatureHeaderSize + signatureHeader.StartHeader.NextHeaderOffset
+	header, _, err := headers.ReadPackedStreamsForHeaders(&io.LimitedReader{R: bytes.NewReader(data[offset:]), N: signatureHeader.StartHeader.NextHeaderSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packInfo := header.MainStreamsInfo.PackInfo
+	pos := headers.SignatureHeaderSize + int64(packInfo.PackPos)
+	for _, size := range packInfo.PackSizes {
+		packInfo.Digests = append(packInfo.Digests, crc32.ChecksumIEEE(data[pos:pos+int64(size)]))
+		pos += int64(size)
+	}
+
+	var buf bytes.Buffer
+	if err := headers.WritePackedStreamsForHeaders(&buf, header, nil); err != nil {
+		t.Fatal(err)
+	}
+	signatureHeader.StartHeader.NextHeaderSize = int64(buf.Len())
+	signatureHeader.StartHeader.NextHeaderCRC = crc32.ChecksumIEEE(buf.Bytes())
+
+	var archive bytes.Buffer
+	if err := headers.WriteSignatureHeader(&archive, signatureHeader); err != nil {
+		t.Fatal(err)
+	}
+	archive.Write(data[headers.SignatureHeaderSize:offset])
+	archive.Write(buf.Bytes())
+
+	return archive.Bytes()
+}
+
+func TestReaderPackChecksum(t *testing.T) {
+	data := packChecksumTestArchive(t)
+
+	sz, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sz.folders[0].packs[0].crc == 0 {
+		t.Fatal("expected pack stream crc")
+	}
+	for _, entry := range testEntries {
+		if _, err := sz.Next(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(ioutil.Discard, sz); err != nil {
+			t.Fatalf("%v: %v", entry.Name, err)
+		}
+	}
+
+	// a mismatched pack stream is reported even if every file matches its crc
+	sz, err = NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sz.folders[0].packs[0].crc ^= 1
+
+	var packErr *PackChecksumError
+	for err == nil {
+		if _, err = sz.Next(); err == nil {
+			_, err = io.Copy(ioutil.Discard, sz)
+		}
+	}
+	if !errors.As(err, &packErr) {
+		t.Fatalf("expected pack stream checksum error, got %v", err)
+	}
+
+	// corrupt the first file's contents
+	data[headers.SignatureHeaderSize] ^= 1
+
+	sz, err = NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first file's crc mismatch is caused by its corrupt pack stream
+	var name string
+	for {
+		var hdr *headers.FileInfo
+		if hdr, err = sz.Next(); err != nil {
+			break
+		}
+		name = hdr.Name
+		if _, err = io.Copy(ioutil.Discard, sz); err != nil {
+			break
+		}
+	}
+
+	if !errors.As(err, &packErr) || packErr.Index != 0 {
+		t.Fatalf("expected pack stream 0 checksum error, got %v", err)
+	}
+	if !errors.Is(err, headers.ErrChecksumMismatch) {
+		t.Fatalf("expected error to be headers.ErrChecksumMismatch")
+	}
+	if name != "dir/hello.txt" {
+		t.Fatalf("expected error reading dir/hello.txt, got %v", name)
+	}
+}
+
+func TestReaderFolders(t *testing.T) {
+	sz := openTestArchive(t, testEntries, nil)
+
+	folders := sz.Folders()
+	if len(folders) != 1 {
+		t.Fatalf("expected 1 folder, got %d", len(folders))
+	}
+	if method := folders[0].Method(); !strings.HasPrefix(method, "LZMA2:") {
+		t.Errorf("expected LZMA2 method, got %q", method)
+	}
+	if folders[0].PackedSize() == 0 || folders[0].PackedSize() >= folders[0].UnpackSize() {
+		t.Errorf("unexpected packed size %d for unpacked size %d", folders[0].PackedSize(), folders[0].UnpackSize())
+	}
+
+	var files []*File
+	for _, f := range sz.File {
+		if f.FolderIndex() == 0 {
+			files = append(files, f)
+		} else if f.FolderIndex() != -1 {
+			t.Errorf("%s: unexpected folder %d", f.Name, f.FolderIndex())
+		}
+	}
+	if len(files) == 0 || !reflect.DeepEqual(files, folders[0].Files) {
+		t.Errorf("expected folder files %v, got %v", files, folders[0].Files)
+	}
+}
+
+func TestRegisteredDecompressors(t *testing.T) {
+	methods := RegisteredDecompressors()
+	for i, id := range methods {
+		if decompressor(id) == nil {
+			t.Errorf("%s (%#x) listed but not registered", headers.MethodName(id), id)
+		}
+		if i > 0 && methods[i-1] >= id {
+			t.Errorf("methods not in ascending order: %#x, %#x", methods[i-1], id)
+		}
+	}
+
+	for _, name := range []string{"Copy", "LZMA", "LZMA2", "BCJ2", "7zAES"} {
+		found := false
+		for _, id := range methods {
+			found = found || headers.MethodName(id) == name
+		}
+		if !found {
+			t.Errorf("%s not registered", name)
+		}
+	}
+}
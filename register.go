@@ -1,13 +1,14 @@
 package go7z
 
 import (
-	"bytes"
 	"compress/bzip2"
 	"compress/flate"
 	"encoding/binary"
 	"io"
+	"sort"
 	"sync"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/saracen/go7z/filters"
 	"github.com/ulikunitz/xz/lzma"
 )
@@ -16,8 +17,14 @@ import (
 // initialized.
 type Decompressor func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error)
 
+// Compressor is a handler function called when a registered compressor is
+// initialized. It returns the writer compressed data is written through and
+// the coder properties to store in the archive header.
+type Compressor func(w io.Writer, wo *WriterOptions) (io.WriteCloser, []byte, error)
+
 var (
 	decompressors sync.Map // map[uint32]Decompressor
+	compressors   sync.Map // map[uint32]Compressor
 )
 
 func init() {
@@ -40,31 +47,30 @@ func init() {
 
 	// lzma
 	RegisterDecompressor(0x030101, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
-		if len(r) != 1 {
+		if len(r) != 1 || len(options) != 5 {
 			return nil, ErrNotSupported
 		}
-
-		// We can't set options in the lzma decoder library, so instead we add
-		// a fake header
-		header := bytes.NewBuffer(options)
-		binary.Write(header, binary.LittleEndian, unpackSize)
-
-		return lzma.NewReader(io.MultiReader(header, r[0]))
+		return filters.NewLZMADecoder(r[0], options, int64(unpackSize))
 	}))
 
 	// lzma2
 	RegisterDecompressor(0x21, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
-		if len(r) != 1 {
+		if len(r) != 1 || len(options) != 1 {
 			return nil, ErrNotSupported
 		}
+		return filters.NewLZMA2Decoder(r[0], options, int64(unpackSize))
+	}))
 
-		config := lzma.Reader2Config{}
-		if len(options) > 0 {
-			config.DictCap = int(2 | (options[0] & 1))
-			config.DictCap <<= (options[0] >> 1) + 11
+	// ppmd
+	RegisterDecompressor(0x030401, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
+		if len(r) != 1 || len(options) != 5 {
+			return nil, ErrNotSupported
 		}
 
-		return config.NewReader2(r[0])
+		order := int(options[0])
+		memSize := binary.LittleEndian.Uint32(options[1:])
+
+		return filters.NewPPMdDecoder(r[0], order, memSize, int64(unpackSize))
 	}))
 
 	// bcj2
@@ -75,6 +81,16 @@ func init() {
 		return filters.NewBCJ2Decoder(r[0], r[1], r[2], r[3], int64(unpackSize))
 	}))
 
+	// branch converters
+	RegisterDecompressor(0x03030103, branchDecompressor(filters.NewBCJDecoder, 1))
+	RegisterDecompressor(0x03030205, branchDecompressor(filters.NewPPCDecoder, 1))
+	RegisterDecompressor(0x03030401, branchDecompressor(filters.NewIA64Decoder, 1))
+	RegisterDecompressor(0x03030501, branchDecompressor(filters.NewARMDecoder, 1))
+	RegisterDecompressor(0x03030701, branchDecompressor(filters.NewARMTDecoder, 1))
+	RegisterDecompressor(0x03030805, branchDecompressor(filters.NewSPARCDecoder, 1))
+	RegisterDecompressor(0xa, branchDecompressor(filters.NewARM64Decoder, 4))
+	RegisterDecompressor(0xb, branchDecompressor(filters.NewRISCVDecoder, 2))
+
 	// deflate
 	RegisterDecompressor(0x40108, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
 		if len(r) != 1 {
@@ -83,6 +99,28 @@ func init() {
 		return flate.NewReader(r[0]), nil
 	}))
 
+	// swap2 and swap4
+	RegisterDecompressor(0x20302, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
+		if len(r) != 1 || len(options) != 0 {
+			return nil, ErrNotSupported
+		}
+		return filters.NewSwap2Decoder(r[0])
+	}))
+	RegisterDecompressor(0x20304, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
+		if len(r) != 1 || len(options) != 0 {
+			return nil, ErrNotSupported
+		}
+		return filters.NewSwap4Decoder(r[0])
+	}))
+
+	// deflate64
+	RegisterDecompressor(0x40109, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
+		if len(r) != 1 {
+			return nil, ErrNotSupported
+		}
+		return filters.NewDeflate64Decoder(r[0])
+	}))
+
 	// bzip2
 	RegisterDecompressor(0x40202, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
 		if len(r) != 1 {
@@ -92,6 +130,50 @@ func init() {
 		return bzip2.NewReader(r[0]), nil
 	}))
 
+	// zstd, as used by 7-Zip-zstd. The properties hold the version of the
+	// zstd library and compression level used, which aren't needed to decode.
+	// Frames may be preceded by skippable frames recording their size, which
+	// the decoder skips.
+	RegisterDecompressor(0x4f71101, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
+		if len(r) != 1 || (len(options) != 3 && len(options) != 5) {
+			return nil, ErrNotSupported
+		}
+
+		opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+		if ro.limits.MaxDictionarySize > 0 {
+			opts = append(opts, zstd.WithDecoderMaxWindow(ro.limits.MaxDictionarySize))
+		}
+
+		return zstd.NewReader(r[0], opts...)
+	}))
+
+	// brotli, lz4, lz5 and lizard, as used by 7-Zip-zstd, with the same
+	// properties as zstd.
+	RegisterDecompressor(0x4f71102, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
+		if len(r) != 1 || (len(options) != 3 && len(options) != 5) {
+			return nil, ErrNotSupported
+		}
+		return filters.NewBrotliDecoder(r[0])
+	}))
+	RegisterDecompressor(0x4f71104, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
+		if len(r) != 1 || (len(options) != 3 && len(options) != 5) {
+			return nil, ErrNotSupported
+		}
+		return filters.NewLZ4Decoder(r[0])
+	}))
+	RegisterDecompressor(0x4f71105, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
+		if len(r) != 1 || (len(options) != 3 && len(options) != 5) {
+			return nil, ErrNotSupported
+		}
+		return filters.NewLZ5Decoder(r[0])
+	}))
+	RegisterDecompressor(0x4f71106, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
+		if len(r) != 1 || (len(options) != 3 && len(options) != 5) {
+			return nil, ErrNotSupported
+		}
+		return filters.NewLizardDecoder(r[0])
+	}))
+
 	// AES
 	RegisterDecompressor(0x6f10701, Decompressor(func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
 		if len(r) != 1 {
@@ -106,13 +188,148 @@ func init() {
 		power := int(options[0]) & 0x3f
 
 		options = options[2:]
+		if len(options) < int(saltSize+ivSize) {
+			return nil, ErrNotSupported
+		}
 		salt := options[:saltSize]
 		iv := options[saltSize : saltSize+ivSize]
 
-		return filters.NewAESDecrypter(r[0], power, salt, iv, ro.Password())
+		return filters.NewAESDecrypterContext(ro.Context(), r[0], power, salt, iv, ro.Password())
+	}))
+
+	// copy
+	RegisterCompressor(0x00, Compressor(func(w io.Writer, wo *WriterOptions) (io.WriteCloser, []byte, error) {
+		return nopWriteCloser{w}, nil, nil
 	}))
+
+	// lzma2
+	RegisterCompressor(0x21, Compressor(func(w io.Writer, wo *WriterOptions) (io.WriteCloser, []byte, error) {
+		config := lzma.Writer2Config{DictCap: wo.dictCap}
+		if config.DictCap == 0 {
+			config.DictCap = 8 << 20
+		}
+
+		// find the smallest dictionary size property that can hold the
+		// dictionary capacity
+		var prop byte
+		for prop = 0; prop < 40; prop++ {
+			if int64(2|(prop&1))<<((prop>>1)+11) >= int64(config.DictCap) {
+				break
+			}
+		}
+
+		lw, err := config.NewWriter2(w)
+		if err != nil {
+			return nil, nil, err
+		}
+		return lw, []byte{prop}, nil
+	}))
+
+	// lzma
+	RegisterCompressor(0x030101, Compressor(func(w io.Writer, wo *WriterOptions) (io.WriteCloser, []byte, error) {
+		config := lzma.WriterConfig{
+			Properties: &lzma.Properties{LC: 3, LP: 0, PB: 2},
+			DictCap:    wo.dictCap,
+			EOSMarker:  true,
+		}
+		if config.DictCap == 0 {
+			config.DictCap = 8 << 20
+		}
+
+		// The lzma library writes a header, which 7z instead stores as the
+		// coder properties, so it is skipped
+		properties := make([]byte, 5)
+		properties[0] = byte((config.Properties.PB*5+config.Properties.LP)*9 + config.Properties.LC)
+		binary.LittleEndian.PutUint32(properties[1:], uint32(config.DictCap))
+
+		lw, err := config.NewWriter(&skipWriter{w: w, n: 13})
+		if err != nil {
+			return nil, nil, err
+		}
+		return lw, properties, nil
+	}))
+
+	// AES
+	RegisterCompressor(0x6f10701, Compressor(func(w io.Writer, wo *WriterOptions) (io.WriteCloser, []byte, error) {
+		// the key is derived once, and shared by each of the writer's folders
+		if wo.aesKey == nil {
+			power := wo.power
+			if power == 0 {
+				power = filters.AESDefaultPower
+			}
+
+			key, err := filters.NewAESKey(power, wo.password)
+			if err != nil {
+				return nil, nil, err
+			}
+			wo.aesKey = key
+		}
+
+		e, err := filters.NewAESEncrypter(w, wo.aesKey)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		salt, iv := wo.aesKey.Salt(), e.IV()
+		properties := []byte{
+			byte(wo.aesKey.Power()) | 0xc0,
+			byte(len(salt)-1)<<4 | byte(len(iv)-1),
+		}
+		properties = append(properties, salt...)
+		properties = append(properties, iv...)
+
+		return e, properties, nil
+	}))
+}
+
+// skipWriter discards the first n bytes written to it.
+type skipWriter struct {
+	w io.Writer
+	n int
+}
+
+func (sw *skipWriter) Write(p []byte) (int, error) {
+	skip := sw.n
+	if skip > len(p) {
+		skip = len(p)
+	}
+	sw.n -= skip
+
+	n, err := sw.w.Write(p[skip:])
+	return skip + n, err
 }
 
+// branchDecompressor returns a Decompressor for a branch converter filter,
+// which has an optional start offset property. Like 7-Zip, start offsets that
+// aren't a multiple of the filter's instruction alignment are rejected.
+func branchDecompressor(newDecoder func(io.Reader, uint32) (*filters.BranchDecoder, error), alignment uint32) Decompressor {
+	return func(r []io.Reader, options []byte, unpackSize uint64, ro *ReaderOptions) (io.Reader, error) {
+		if len(r) != 1 {
+			return nil, ErrNotSupported
+		}
+
+		var startOffset uint32
+		switch len(options) {
+		case 0:
+		case 4:
+			startOffset = binary.LittleEndian.Uint32(options)
+		default:
+			return nil, ErrNotSupported
+		}
+		if startOffset%alignment != 0 {
+			return nil, ErrNotSupported
+		}
+
+		return newDecoder(r[0], startOffset)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
 // RegisterDecompressor registers a decompressor.
 func RegisterDecompressor(method uint32, dcomp Decompressor) {
 	if _, dup := decompressors.LoadOrStore(method, dcomp); dup {
@@ -120,6 +337,18 @@ func RegisterDecompressor(method uint32, dcomp Decompressor) {
 	}
 }
 
+// RegisteredDecompressors returns the codec IDs of the registered
+// decompressors in ascending order. headers.MethodName returns their names.
+func RegisteredDecompressors() []uint32 {
+	var methods []uint32
+	decompressors.Range(func(key, value interface{}) bool {
+		methods = append(methods, key.(uint32))
+		return true
+	})
+	sort.Slice(methods, func(i, j int) bool { return methods[i] < methods[j] })
+	return methods
+}
+
 func decompressor(method uint32) Decompressor {
 	di, ok := decompressors.Load(method)
 	if !ok {
@@ -127,3 +356,18 @@ func decompressor(method uint32) Decompressor {
 	}
 	return di.(Decompressor)
 }
+
+// RegisterCompressor registers a compressor.
+func RegisterCompressor(method uint32, comp Compressor) {
+	if _, dup := compressors.LoadOrStore(method, comp); dup {
+		panic("compressor already registered")
+	}
+}
+
+func compressor(method uint32) Compressor {
+	ci, ok := compressors.Load(method)
+	if !ok {
+		return nil
+	}
+	return ci.(Compressor)
+}
@@ -0,0 +1,717 @@
+package go7z
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/huff0"
+	"github.com/klauspost/compress/zstd"
+	"github.com/saracen/go7z/filters"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+func TestZstdDecompressor(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+
+	chunks := [][]byte{
+		[]byte("hello world\n"),
+		bytes.Repeat([]byte("0123456789abcdef"), 64*1024),
+	}
+	expected := bytes.Join(chunks, nil)
+
+	// 7-Zip-zstd compresses chunks as separate frames, each preceded by a
+	// skippable frame holding its compressed size
+	var plain, chunked bytes.Buffer
+	plain.Write(enc.EncodeAll(expected, nil))
+	for _, chunk := range chunks {
+		frame := enc.EncodeAll(chunk, nil)
+		binary.Write(&chunked, binary.LittleEndian, []uint32{0x184d2a50, 4, uint32(len(frame))})
+		chunked.Write(frame)
+	}
+
+	d := decompressor(0x4f71101)
+	for _, compressed := range []*bytes.Buffer{&plain, &chunked} {
+		r, err := d([]io.Reader{bytes.NewReader(compressed.Bytes())}, []byte{1, 5, 3, 0, 0}, uint64(len(expected)), &ReaderOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, expected) {
+			t.Fatalf("contents mismatch")
+		}
+	}
+
+	if _, err = d([]io.Reader{&plain}, []byte{1}, 0, &ReaderOptions{}); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestBrotliDecompressor(t *testing.T) {
+	chunks := [][]byte{
+		[]byte("hello world\n"),
+		bytes.Repeat([]byte("0123456789abcdef"), 64*1024),
+	}
+	expected := bytes.Join(chunks, nil)
+
+	compress := func(b []byte) []byte {
+		var buf bytes.Buffer
+		w := brotli.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+
+	// 7-Zip-zstd compresses chunks as separate streams, each preceded by a
+	// skippable frame holding its compressed and uncompressed sizes
+	var plain, chunked bytes.Buffer
+	plain.Write(compress(expected))
+	for _, chunk := range chunks {
+		stream := compress(chunk)
+		binary.Write(&chunked, binary.LittleEndian, []uint32{0x184d2a50, 8, uint32(len(stream))})
+		binary.Write(&chunked, binary.LittleEndian, []uint16{0x5242, uint16(len(chunk) >> 16)})
+		chunked.Write(stream)
+	}
+
+	d := decompressor(0x4f71102)
+	for _, compressed := range []*bytes.Buffer{&plain, &chunked} {
+		r, err := d([]io.Reader{bytes.NewReader(compressed.Bytes())}, []byte{1, 0, 6}, uint64(len(expected)), &ReaderOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, expected) {
+			t.Fatalf("contents mismatch")
+		}
+	}
+}
+
+func TestLZ4Decompressor(t *testing.T) {
+	frames := [][]byte{
+		// linked blocks
+		{0x04, 0x22, 0x4d, 0x18, 0x40, 0x40, 0x00},
+		{0x08, 0x00, 0x00, 0x00, 0x35, 'a', 'b', 'c', 0x03, 0x00, 0x10, 'x'},
+		{0x05, 0x00, 0x00, 0x00, 0x01, 0x0d, 0x00, 0x10, 'y'},
+		{0x03, 0x00, 0x00, 0x80, 'z', 'z', 'z'},
+		{0x00, 0x00, 0x00, 0x00},
+
+		// skippable frame
+		{0x50, 0x2a, 0x4d, 0x18, 0x04, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04},
+
+		// independent blocks, with a content size and block checksums
+		{0x04, 0x22, 0x4d, 0x18, 0x78, 0x40, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		{0x04, 0x00, 0x00, 0x00, 0x30, 'e', 'n', 'd', 0xff, 0xff, 0xff, 0xff},
+		{0x00, 0x00, 0x00, 0x00},
+	}
+
+	d := decompressor(0x4f71104)
+	r, err := d([]io.Reader{bytes.NewReader(bytes.Join(frames, nil))}, []byte{1, 9, 3}, 0, &ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "abcabcabcabcxabcabyzzzend"; string(contents) != expected {
+		t.Fatalf("expected %q, got %q", expected, contents)
+	}
+
+	// independent blocks can't refer to previous blocks
+	frames[0][4] = 0x60
+	r, err = d([]io.Reader{bytes.NewReader(bytes.Join(frames, nil))}, []byte{1, 9, 3}, 0, &ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(r); err != filters.ErrLZ4DataError {
+		t.Fatalf("expected ErrLZ4DataError, got %v", err)
+	}
+}
+
+func TestLZ5Decompressor(t *testing.T) {
+	frames := [][]byte{
+		// linked blocks
+		{0x05, 0x22, 0x4d, 0x18, 0x40, 0x10, 0x00},
+		// 10-bit offset, then literals only
+		{0x08, 0x00, 0x00, 0x00, 0x9e, 0x00, 'a', 'b', 'c', 0x03, 0x08, 'x'},
+		// 24-bit offset, then 16-bit offset with a longer match
+		{0x09, 0x00, 0x00, 0x00, 0x48, 'y', 0x05, 0x00, 0x00, 0x07, 0x02, 0x00, 0x01},
+		{0x03, 0x00, 0x00, 0x80, 'z', 'z', 'z'},
+		{0x00, 0x00, 0x00, 0x00},
+
+		// skippable frame
+		{0x50, 0x2a, 0x4d, 0x18, 0x04, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04},
+
+		// independent blocks, with a last offset match
+		{0x05, 0x22, 0x4d, 0x18, 0x60, 0x10, 0x00},
+		{0x0a, 0x00, 0x00, 0x00, 0x1b, 'e', 'n', 'd', 0x01, 0x00, 0x68, '!', 0x08, '.'},
+		{0x00, 0x00, 0x00, 0x00},
+	}
+
+	d := decompressor(0x4f71105)
+	r, err := d([]io.Reader{bytes.NewReader(bytes.Join(frames, nil))}, []byte{1, 5, 3}, 0, &ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "abcabcabcabcxyabcbcbcbcbcbcbzzzenddddddd!!!!."; string(contents) != expected {
+		t.Fatalf("expected %q, got %q", expected, contents)
+	}
+
+	// independent blocks can't refer to previous blocks
+	frames[0][4] = 0x60
+	r, err = d([]io.Reader{bytes.NewReader(bytes.Join(frames, nil))}, []byte{1, 5, 3}, 0, &ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(r); err != filters.ErrLZ5DataError {
+		t.Fatalf("expected ErrLZ5DataError, got %v", err)
+	}
+}
+
+func TestLizardDecompressor(t *testing.T) {
+	le24 := func(n int) []byte {
+		return []byte{byte(n), byte(n >> 8), byte(n >> 16)}
+	}
+	stream := func(b ...byte) []byte {
+		return append(le24(len(b)), b...)
+	}
+	block := func(parts ...[]byte) []byte {
+		b := bytes.Join(parts, nil)
+		size := make([]byte, 4)
+		binary.LittleEndian.PutUint32(size, uint32(len(b)))
+		return append(size, b...)
+	}
+
+	// literals compressed with Huffman coding
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 20)
+	literals, _, err := huff0.Compress4X(text, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := [][]byte{
+		// linked blocks
+		{0x06, 0x22, 0x4d, 0x18, 0x40, 0x10, 0x00},
+
+		// LIZv1 tokens: a 16-bit offset, the last offset, a 24-bit offset,
+		// and a 24-bit offset with a longer match
+		block(
+			[]byte{20, 0x00},
+			stream(0x00),
+			stream(0x03, 0x00),
+			stream(0x02, 0x00, 0x00, 0x01, 0x00, 0x00),
+			stream(0x4b, 0x99, 0x02, 0x1f),
+			stream('a', 'b', 'c', 'y', 'x'),
+		),
+
+		// LZ4 tokens with Huffman coded literals, matching the previous
+		// block, followed by a stored part
+		block(
+			[]byte{30, 0x01},
+			stream(0xfe, byte(len(text)-15), byte((len(text)-15)>>8), 0x01),
+			stream(byte(len(text)+1), byte((len(text)+1)>>8)),
+			stream(),
+			stream(0xff),
+			append(append(le24(len(text)), le24(len(literals))...), literals...),
+			[]byte{0x80},
+			stream('z', 'z', 'z'),
+		),
+		{0x00, 0x00, 0x00, 0x00},
+
+		// skippable frame
+		{0x50, 0x2a, 0x4d, 0x18, 0x04, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04},
+
+		// independent blocks, with a stored block
+		{0x06, 0x22, 0x4d, 0x18, 0x60, 0x10, 0x00},
+		{0x03, 0x00, 0x00, 0x80, 'e', 'n', 'd'},
+		{0x00, 0x00, 0x00, 0x00},
+	}
+
+	var expected []byte
+	expected = append(expected, "abcabcabcabcybcy"...)
+	expected = append(expected, bytes.Repeat([]byte("cy"), 9)...)
+	expected = append(expected, bytes.Repeat([]byte("y"), 47)...)
+	expected = append(expected, 'x')
+	expected = append(expected, text...)
+	expected = append(expected, 'x')
+	expected = append(expected, text[:19]...)
+	expected = append(expected, "zzzend"...)
+
+	d := decompressor(0x4f71106)
+	r, err := d([]io.Reader{bytes.NewReader(bytes.Join(frames, nil))}, []byte{1, 0, 20}, 0, &ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents, expected) {
+		t.Fatalf("expected %q, got %q", expected, contents)
+	}
+
+	// independent blocks can't refer to previous blocks
+	frames[0][4] = 0x60
+	r, err = d([]io.Reader{bytes.NewReader(bytes.Join(frames, nil))}, []byte{1, 0, 20}, 0, &ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(r); err != filters.ErrLizardDataError {
+		t.Fatalf("expected ErrLizardDataError, got %v", err)
+	}
+}
+
+// bitWriter writes deflate bit streams.
+type bitWriter struct {
+	buf   bytes.Buffer
+	bits  uint32
+	nbits uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	for i := uint(0); i < n; i++ {
+		w.bits |= (v >> i & 1) << w.nbits
+		w.nbits++
+		if w.nbits == 8 {
+			w.flush()
+		}
+	}
+}
+
+// writeCode writes a Huffman code, which is stored most significant bit first.
+func (w *bitWriter) writeCode(code uint32, n uint) {
+	for i := n; i > 0; i-- {
+		w.write(code>>(i-1)&1, 1)
+	}
+}
+
+func (w *bitWriter) flush() {
+	if w.nbits > 0 {
+		w.buf.WriteByte(byte(w.bits))
+		w.bits, w.nbits = 0, 0
+	}
+}
+
+func TestDeflate64Decompressor(t *testing.T) {
+	d := decompressor(0x40109)
+	decompress := func(compressed []byte) ([]byte, error) {
+		r, err := d([]io.Reader{bytes.NewReader(compressed)}, nil, 0, &ReaderOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ioutil.ReadAll(r)
+	}
+
+	rnd := rand.New(rand.NewSource(0))
+	random := make([]byte, 40000)
+	rnd.Read(random)
+
+	// deflate streams are valid deflate64 streams, provided they don't use
+	// length code 285, so the text mustn't have matches of 258 bytes
+	words := []string{"the ", "quick ", "brown ", "fox ", "jumps ", "over ", "lazy ", "dog. "}
+	var text []byte
+	for len(text) < 64*1024 {
+		text = append(text, words[rnd.Intn(len(words))]...)
+	}
+	for _, level := range []int{flate.NoCompression, flate.BestSpeed, flate.BestCompression, flate.HuffmanOnly} {
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, level)
+		w.Write(random)
+		w.Write(text)
+		w.Close()
+
+		contents, err := decompress(buf.Bytes())
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if !bytes.Equal(contents, append(random, text...)) {
+			t.Fatalf("level %d: contents mismatch", level)
+		}
+	}
+
+	// a stored block, followed by a fixed block with a match using deflate64's
+	// length code 285 and distance code 30
+	var w bitWriter
+	w.write(0, 3)
+	w.flush()
+	w.write(uint32(len(random)), 16)
+	w.write(^uint32(len(random)), 16)
+	w.buf.Write(random)
+
+	w.write(1|1<<1, 3)
+	w.writeCode(0xc0+285-280, 8)
+	w.write(1000-3, 16)
+	w.writeCode(30, 5)
+	w.write(40000-32769, 14)
+	w.writeCode(0, 7)
+	w.flush()
+
+	contents, err := decompress(w.buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents, append(random, random[:1000]...)) {
+		t.Fatalf("contents mismatch")
+	}
+
+	// distances can't exceed the data decoded
+	w = bitWriter{}
+	w.write(1|1<<1, 3)
+	w.writeCode(257-256, 7)
+	w.writeCode(0, 5)
+	w.flush()
+	if _, err = decompress(w.buf.Bytes()); err != filters.ErrDeflate64DataError {
+		t.Fatalf("expected ErrDeflate64DataError, got %v", err)
+	}
+}
+
+func TestSwapDecompressors(t *testing.T) {
+	tests := []struct {
+		method  uint32
+		in, out string
+	}{
+		{0x20302, "", ""},
+		{0x20302, "abcdef", "badcfe"},
+		{0x20302, "abcdefg", "badcfeg"},
+		{0x20304, "abcdefgh", "dcbahgfe"},
+		{0x20304, "abcdefghij", "dcbahgfeij"},
+	}
+
+	for _, tc := range tests {
+		d := decompressor(tc.method)
+
+		// words split across reads are still swapped
+		r, err := d([]io.Reader{iotest.OneByteReader(bytes.NewReader([]byte(tc.in)))}, nil, uint64(len(tc.in)), &ReaderOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != tc.out {
+			t.Errorf("%#x: expected %q, got %q", tc.method, tc.out, contents)
+		}
+	}
+}
+
+func TestBranchDecompressors(t *testing.T) {
+	// branches as converted by 7-Zip's encoders, with a start offset of
+	// 0x1000, and the original instructions they decode to
+	tests := []struct {
+		name    string
+		method  uint32
+		encoded []byte
+		decoded []byte
+	}{
+		{
+			// slot 2 of an MIB bundle: br.call +0x100
+			"IA64", 0x03030401,
+			[]byte{0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x11, 0, 0x50},
+			[]byte{0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0, 0x50},
+		},
+		{
+			// bl +0x1000
+			"ARMT", 0x03030701,
+			[]byte{0x02, 0xf0, 0x02, 0xf8},
+			[]byte{0x01, 0xf0, 0x00, 0xf8},
+		},
+		{
+			// call +0x400, call -4
+			"SPARC", 0x03030805,
+			[]byte{0x40, 0x00, 0x05, 0x00, 0x40, 0x00, 0x04, 0x00},
+			[]byte{0x40, 0x00, 0x01, 0x00, 0x7f, 0xff, 0xff, 0xff},
+		},
+		{
+			// bl +0x40, adrp x1, +0x1000
+			"ARM64", 0xa,
+			[]byte{0x10, 0x04, 0x00, 0x94, 0x01, 0x00, 0x00, 0xd0},
+			[]byte{0x10, 0x00, 0x00, 0x94, 0x01, 0x00, 0x00, 0xb0},
+		},
+		{
+			// jal ra, +0x800
+			"RISCV JAL", 0xb,
+			[]byte{0xef, 0x00, 0x0c, 0x00, 0, 0, 0, 0},
+			[]byte{0xef, 0x00, 0x10, 0x00, 0, 0, 0, 0},
+		},
+		{
+			// auipc ra, 0x1; jalr ra, 0x10(ra)
+			"RISCV AUIPC", 0xb,
+			[]byte{0x17, 0x71, 0x0e, 0x08, 0x00, 0x00, 0x20, 0x10},
+			[]byte{0x97, 0x10, 0x00, 0x00, 0xe7, 0x80, 0x00, 0x01},
+		},
+	}
+
+	options := make([]byte, 4)
+	binary.LittleEndian.PutUint32(options, 0x1000)
+
+	for _, tc := range tests {
+		r, err := decompressor(tc.method)([]io.Reader{bytes.NewReader(tc.encoded)}, options, uint64(len(tc.decoded)), &ReaderOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		decoded, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !bytes.Equal(decoded, tc.decoded) {
+			t.Errorf("%s: expected % x, got % x", tc.name, tc.decoded, decoded)
+		}
+	}
+}
+
+func TestBranchDecompressorAlignment(t *testing.T) {
+	tests := []struct {
+		method      uint32
+		startOffset uint32
+		err         error
+	}{
+		{0x03030103, 1, nil},
+		{0xa, 4, nil},
+		{0xa, 2, ErrNotSupported},
+		{0xb, 2, nil},
+		{0xb, 1, ErrNotSupported},
+	}
+
+	for _, tc := range tests {
+		options := make([]byte, 4)
+		binary.LittleEndian.PutUint32(options, tc.startOffset)
+
+		_, err := decompressor(tc.method)([]io.Reader{bytes.NewReader(nil)}, options, 0, &ReaderOptions{})
+		if err != tc.err {
+			t.Errorf("%#x with start offset %d: expected %v, got %v", tc.method, tc.startOffset, tc.err, err)
+		}
+	}
+}
+
+// lzmaTestData returns data that compresses to a mix of literals, short and
+// long matches, and for LZMA2, uncompressed chunks.
+func lzmaTestData(size int) []byte {
+	rnd := rand.New(rand.NewSource(0))
+	words := []string{"the ", "quick ", "brown ", "fox ", "jumps ", "over ", "lazy ", "dog. "}
+
+	var data []byte
+	for len(data) < size {
+		switch rnd.Intn(3) {
+		case 0:
+			random := make([]byte, rnd.Intn(4096))
+			rnd.Read(random)
+			data = append(data, random...)
+		case 1:
+			data = append(data, bytes.Repeat([]byte{byte(rnd.Intn(256))}, rnd.Intn(1024))...)
+		default:
+			for i := rnd.Intn(1024); i > 0; i-- {
+				data = append(data, words[rnd.Intn(len(words))]...)
+			}
+		}
+	}
+	return data[:size]
+}
+
+// compressLZMA compresses data, returning the 7z coder properties and the
+// stream.
+func compressLZMA(tb testing.TB, data []byte, props lzma.Properties, size int64, eos bool) ([]byte, []byte) {
+	var buf bytes.Buffer
+	config := lzma.WriterConfig{
+		Properties:   &props,
+		DictCap:      1 << 16,
+		SizeInHeader: size >= 0,
+		Size:         size,
+		EOSMarker:    eos,
+	}
+	w, err := config.NewWriter(&buf)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	w.Write(data)
+	if err = w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+
+	// the header is the properties followed by the size
+	return buf.Bytes()[:5], buf.Bytes()[13:]
+}
+
+func compressLZMA2(tb testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := lzma.Writer2Config{DictCap: 1 << 16}.NewWriter2(&buf)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	w.Write(data)
+	if err = w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLZMADecompressor(t *testing.T) {
+	data := lzmaTestData(256 * 1024)
+
+	tests := []struct {
+		props lzma.Properties
+		size  int64
+		eos   bool
+	}{
+		{lzma.Properties{LC: 3, LP: 0, PB: 2}, int64(len(data)), false},
+		{lzma.Properties{LC: 0, LP: 2, PB: 0}, int64(len(data)), true},
+		{lzma.Properties{LC: 4, LP: 0, PB: 4}, -1, true},
+	}
+
+	for _, tc := range tests {
+		props, compressed := compressLZMA(t, data, tc.props, tc.size, tc.eos)
+
+		// end marker streams can be decoded without knowing the size
+		r, err := filters.NewLZMADecoder(iotest.OneByteReader(bytes.NewReader(compressed)), props, tc.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents, err := ioutil.ReadAll(iotest.HalfReader(r))
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.props, err)
+		}
+		if !bytes.Equal(contents, data) {
+			t.Fatalf("%+v: contents mismatch", tc.props)
+		}
+	}
+
+	if _, err := filters.NewLZMADecoder(bytes.NewReader(nil), []byte{225, 0, 0, 1, 0}, 0); err != filters.ErrLZMAInvalidProperties {
+		t.Fatalf("expected ErrLZMAInvalidProperties, got %v", err)
+	}
+}
+
+func TestLZMA2Decompressor(t *testing.T) {
+	data := lzmaTestData(256 * 1024)
+	compressed := compressLZMA2(t, data)
+
+	d := decompressor(0x21)
+	r, err := d([]io.Reader{iotest.OneByteReader(bytes.NewReader(compressed))}, []byte{8}, uint64(len(data)), &ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadAll(iotest.HalfReader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents, data) {
+		t.Fatalf("contents mismatch")
+	}
+
+	// corruption is reported with its offset
+	tests := []struct {
+		offset int
+		value  byte
+	}{
+		{0, 0x80},                   // the first chunk doesn't reset the dictionary
+		{5, 9 * 5 * 5},              // invalid properties
+		{6, 0x01},                   // invalid range coder header
+		{len(compressed) - 1, 0x03}, // invalid chunk header
+	}
+
+	for _, tc := range tests {
+		corrupt := append([]byte{}, compressed...)
+		corrupt[tc.offset] = tc.value
+
+		r, err := d([]io.Reader{bytes.NewReader(corrupt)}, []byte{8}, uint64(len(data)), &ReaderOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var dataErr *filters.LZMADataError
+		_, err = ioutil.ReadAll(r)
+		if !errors.As(err, &dataErr) || !errors.Is(err, filters.ErrLZMADataError) {
+			t.Fatalf("offset %d: expected LZMADataError, got %v", tc.offset, err)
+		}
+		if dataErr.Offset != int64(tc.offset) {
+			t.Errorf("expected corruption at offset %d, got %d", tc.offset, dataErr.Offset)
+		}
+	}
+}
+
+func BenchmarkLZMADecompressor(b *testing.B) {
+	data := lzmaTestData(4 << 20)
+	props, compressed := compressLZMA(b, data, lzma.Properties{LC: 3, LP: 0, PB: 2}, int64(len(data)), false)
+
+	// the lzma library's reader, given the fake header it requires
+	header := make([]byte, 13)
+	copy(header, props)
+	binary.LittleEndian.PutUint64(header[5:], uint64(len(data)))
+
+	newReaders := map[string]func() (io.Reader, error){
+		"native": func() (io.Reader, error) {
+			return filters.NewLZMADecoder(bytes.NewReader(compressed), props, int64(len(data)))
+		},
+		"xz": func() (io.Reader, error) {
+			return lzma.NewReader(io.MultiReader(bytes.NewReader(header), bytes.NewReader(compressed)))
+		},
+	}
+
+	for name, newReader := range newReaders {
+		b.Run(name, func(b *testing.B) {
+			benchmarkDecompressor(b, newReader, int64(len(data)))
+		})
+	}
+}
+
+func BenchmarkLZMA2Decompressor(b *testing.B) {
+	data := lzmaTestData(4 << 20)
+	compressed := compressLZMA2(b, data)
+
+	newReaders := map[string]func() (io.Reader, error){
+		"native": func() (io.Reader, error) {
+			return filters.NewLZMA2Decoder(bytes.NewReader(compressed), []byte{8}, int64(len(data)))
+		},
+		"xz": func() (io.Reader, error) {
+			return lzma.Reader2Config{DictCap: 1 << 16}.NewReader2(bytes.NewReader(compressed))
+		},
+	}
+
+	for name, newReader := range newReaders {
+		b.Run(name, func(b *testing.B) {
+			benchmarkDecompressor(b, newReader, int64(len(data)))
+		})
+	}
+}
+
+func benchmarkDecompressor(b *testing.B, newReader func() (io.Reader, error), size int64) {
+	b.SetBytes(size)
+	for i := 0; i < b.N; i++ {
+		r, err := newReader()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n, err := io.Copy(ioutil.Discard, r); err != nil || n != size {
+			b.Fatalf("decompressed %d bytes: %v", n, err)
+		}
+	}
+}
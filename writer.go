@@ -0,0 +1,486 @@
+package go7z
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/saracen/go7z/filters"
+	"github.com/saracen/go7z/headers"
+)
+
+var (
+	// ErrWriterClosed is returned when writing to an archive or entry that has
+	// already been closed.
+	ErrWriterClosed = errors.New("writer closed")
+
+	// ErrCompressorNotFound is returned when a requested compressor has not
+	// been registered.
+	ErrCompressorNotFound = errors.New("compressor not found")
+
+	// ErrEntryHasNoContents is returned when writing to an entry that cannot
+	// have contents, such as a directory or anti-item.
+	ErrEntryHasNoContents = errors.New("entry cannot have contents")
+
+	// ErrPasswordRequired is returned when header encryption is enabled
+	// without a password being set.
+	ErrPasswordRequired = errors.New("password required")
+)
+
+const (
+	methodLZMA = 0x030101
+	methodAES  = 0x6f10701
+)
+
+// Writer is a 7z archive writer.
+type Writer struct {
+	w      io.Writer      // where the packed streams and header are written
+	out    io.Writer      // the archive's writer
+	ws     io.WriteSeeker // out, if it can seek
+	buf    *bytes.Buffer  // the archive, if out can't seek
+	start  int64
+	packed int64
+	closed bool
+
+	header headers.Header
+
+	folders   []*folderWriter
+	folder    *folderWriter
+	lastEntry *fileWriter
+
+	Options WriterOptions
+}
+
+// WriterOptions are optional options to configure a 7z archive writer.
+type WriterOptions struct {
+	method   uint32
+	dictCap  int
+	nonSolid bool
+
+	password      string
+	power         int
+	encryptHeader bool
+	aesKey        *filters.AESKey
+}
+
+// SetMethod sets the codec ID of the compressor used for file contents. The
+// compressor must have been registered with RegisterCompressor. LZMA2 is used
+// by default.
+func (o *WriterOptions) SetMethod(method uint32) {
+	o.method = method
+}
+
+// SetDictionarySize sets the dictionary size used by compressors that support
+// it. A size of zero uses the compressor's default.
+func (o *WriterOptions) SetDictionarySize(size int) {
+	o.dictCap = size
+}
+
+// SetSolid sets whether file contents are compressed together in a single
+// solid block. Archives are solid by default. Non-solid archives compress each
+// file separately, allowing files to be decompressed independently.
+func (o *WriterOptions) SetSolid(solid bool) {
+	o.nonSolid = !solid
+}
+
+// SetPassword sets the password used to encrypt file contents with AES-256.
+// File contents are not encrypted if no password is set.
+func (o *WriterOptions) SetPassword(password string) {
+	o.password = password
+	o.aesKey = nil
+}
+
+// SetNumCyclesPower sets the number of key derivation cycles, as a power of
+// two, used for encryption. A power of zero uses filters.AESDefaultPower.
+// Writing encrypted contents fails with filters.ErrAESInvalidPower if the
+// power is negative or greater than filters.AESMaxPower.
+func (o *WriterOptions) SetNumCyclesPower(power int) {
+	o.power = power
+	o.aesKey = nil
+}
+
+// SetHeaderEncryption sets whether the archive header, which includes the file
+// names, is encrypted. Header encryption requires a password to be set.
+func (o *WriterOptions) SetHeaderEncryption(encrypt bool) {
+	o.encryptHeader = encrypt
+}
+
+// NewWriter returns a new Writer writing a 7z archive to w.
+//
+// The signature header at the start of the archive can only be written once
+// Close is called. If w is an io.WriteSeeker, such as an *os.File, the archive
+// starts at w's current offset and Close seeks back to complete the signature
+// header. Otherwise, or if seeking fails, the whole archive is buffered in
+// memory and only written to w by Close.
+func NewWriter(w io.Writer) (*Writer, error) {
+	szw := &Writer{w: w, out: w}
+	szw.Options.method = 0x21 // lzma2
+
+	if ws, ok := w.(io.WriteSeeker); ok {
+		if start, err := ws.Seek(0, io.SeekCurrent); err == nil {
+			szw.ws, szw.start = ws, start
+		}
+	}
+
+	if szw.ws == nil {
+		szw.buf = new(bytes.Buffer)
+		szw.w = szw.buf
+		return szw, nil
+	}
+
+	// placeholder for the signature header
+	var placeholder [headers.SignatureHeaderSize]byte
+	if _, err := w.Write(placeholder[:]); err != nil {
+		return nil, err
+	}
+
+	return szw, nil
+}
+
+// Create adds a file to the archive using the provided FileInfo and returns a
+// Writer to which the file contents should be written. The file's contents
+// must be written before the next call to Create or Close.
+//
+// Entries with IsEmptyStream set and IsEmptyFile unset are directories, and
+// like anti-items, cannot have contents. Files with no contents written are
+// stored as empty files.
+func (sz *Writer) Create(fi *headers.FileInfo) (io.Writer, error) {
+	if sz.closed {
+		return nil, ErrWriterClosed
+	}
+	if sz.Options.encryptHeader && sz.Options.password == "" {
+		return nil, ErrPasswordRequired
+	}
+	if err := sz.closeEntry(); err != nil {
+		return nil, err
+	}
+
+	fh := *fi
+	sz.header.FilesInfo = append(sz.header.FilesInfo, &fh)
+
+	if (fh.IsEmptyStream && !fh.IsEmptyFile) || fh.IsAntiFile {
+		fh.IsEmptyStream = true
+		return noContentsWriter{}, nil
+	}
+
+	sz.lastEntry = &fileWriter{
+		sz:  sz,
+		fi:  &fh,
+		crc: crc32.NewIEEE(),
+	}
+	return sz.lastEntry, nil
+}
+
+// Close finishes writing the archive by writing the archive header and
+// updating the signature header. It does not close the underlying writer.
+func (sz *Writer) Close() error {
+	if sz.closed {
+		return ErrWriterClosed
+	}
+	sz.closed = true
+
+	if err := sz.closeEntry(); err != nil {
+		return err
+	}
+	if err := sz.closeFolder(); err != nil {
+		return err
+	}
+
+	signatureHeader := &headers.SignatureHeader{}
+	signatureHeader.ArchiveVersion.Major = 0
+	signatureHeader.ArchiveVersion.Minor = 4
+
+	// an archive without entries has no header at all
+	if len(sz.header.FilesInfo) > 0 {
+		sz.header.MainStreamsInfo = sz.streamsInfo()
+
+		buf := new(bytes.Buffer)
+		if err := headers.WritePackedStreamsForHeaders(buf, &sz.header, nil); err != nil {
+			return err
+		}
+
+		if sz.Options.encryptHeader {
+			encodedHeader, err := sz.encodeHeader(buf.Bytes())
+			if err != nil {
+				return err
+			}
+
+			buf.Reset()
+			if err := headers.WritePackedStreamsForHeaders(buf, nil, encodedHeader); err != nil {
+				return err
+			}
+		}
+
+		signatureHeader.StartHeader.NextHeaderOffset = sz.packed
+		signatureHeader.StartHeader.NextHeaderSize = int64(buf.Len())
+		signatureHeader.StartHeader.NextHeaderCRC = crc32.ChecksumIEEE(buf.Bytes())
+
+		if _, err := buf.WriteTo(sz.w); err != nil {
+			return err
+		}
+	}
+
+	if sz.ws == nil {
+		if err := headers.WriteSignatureHeader(sz.out, signatureHeader); err != nil {
+			return err
+		}
+		_, err := sz.buf.WriteTo(sz.out)
+		return err
+	}
+
+	end, err := sz.ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = sz.ws.Seek(sz.start, io.SeekStart); err != nil {
+		return err
+	}
+	if err = headers.WriteSignatureHeader(sz.ws, signatureHeader); err != nil {
+		return err
+	}
+	_, err = sz.ws.Seek(end, io.SeekStart)
+	return err
+}
+
+func (sz *Writer) streamsInfo() *headers.StreamsInfo {
+	if len(sz.folders) == 0 {
+		return nil
+	}
+
+	streamsInfo := &headers.StreamsInfo{
+		PackInfo:       &headers.PackInfo{},
+		UnpackInfo:     &headers.UnpackInfo{},
+		SubStreamsInfo: &headers.SubStreamsInfo{},
+	}
+
+	for _, fw := range sz.folders {
+		streamsInfo.PackInfo.PackSizes = append(streamsInfo.PackInfo.PackSizes, fw.packSizes...)
+		streamsInfo.UnpackInfo.Folders = append(streamsInfo.UnpackInfo.Folders, fw.folder)
+
+		ssi := streamsInfo.SubStreamsInfo
+		ssi.NumUnpackStreamsInFolders = append(ssi.NumUnpackStreamsInFolders, len(fw.sizes))
+		ssi.UnpackSizes = append(ssi.UnpackSizes, fw.sizes...)
+		ssi.Digests = append(ssi.Digests, fw.crcs...)
+	}
+
+	return streamsInfo
+}
+
+// encodeHeader writes the header compressed with LZMA and encrypted with AES,
+// and returns the streams info describing it.
+func (sz *Writer) encodeHeader(header []byte) (*headers.StreamsInfo, error) {
+	fw, err := newFolderWriter(sz.w, []uint32{methodLZMA, methodAES}, &sz.Options)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fw.w.Write(header); err != nil {
+		return nil, err
+	}
+	if err = fw.Close(); err != nil {
+		return nil, err
+	}
+	fw.folder.UnpackCRC = crc32.ChecksumIEEE(header)
+
+	streamsInfo := &headers.StreamsInfo{
+		PackInfo: &headers.PackInfo{
+			PackPos:   uint64(sz.packed),
+			PackSizes: fw.packSizes,
+		},
+		UnpackInfo: &headers.UnpackInfo{
+			Folders: []*headers.Folder{fw.folder},
+		},
+	}
+	sz.packed += fw.cw.n
+
+	return streamsInfo, nil
+}
+
+func (sz *Writer) openFolder() error {
+	methods := []uint32{sz.Options.method}
+	if sz.Options.password != "" {
+		methods = append(methods, methodAES)
+	}
+
+	fw, err := newFolderWriter(sz.w, methods, &sz.Options)
+	if err != nil {
+		return err
+	}
+	sz.folder = fw
+
+	return nil
+}
+
+func (sz *Writer) closeFolder() error {
+	if sz.folder == nil {
+		return nil
+	}
+
+	fw := sz.folder
+	sz.folder = nil
+
+	if err := fw.Close(); err != nil {
+		return err
+	}
+
+	sz.packed += fw.cw.n
+	sz.folders = append(sz.folders, fw)
+
+	return nil
+}
+
+func (sz *Writer) closeEntry() error {
+	if sz.lastEntry == nil {
+		return nil
+	}
+
+	fw := sz.lastEntry
+	sz.lastEntry = nil
+	fw.closed = true
+
+	if fw.size == 0 {
+		fw.fi.IsEmptyStream = true
+		fw.fi.IsEmptyFile = true
+		return nil
+	}
+
+	fw.fi.IsEmptyStream = false
+	fw.fi.IsEmptyFile = false
+	sz.folder.sizes = append(sz.folder.sizes, fw.size)
+	sz.folder.crcs = append(sz.folder.crcs, fw.crc.Sum32())
+
+	if sz.Options.nonSolid {
+		return sz.closeFolder()
+	}
+	return nil
+}
+
+// folderWriter writes a folder's contents through a chain of coders. File
+// contents are written to the first method's coder, and the output of each
+// coder is the input of the next, with the last coder's output being packed.
+//
+// Coders are stored in the folder in reverse, so that the packed stream's
+// coder comes first, as they are decoded in that order.
+type folderWriter struct {
+	w       io.Writer
+	cw      *countWriter
+	writers []io.WriteCloser
+	counts  []*countWriter
+
+	folder    *headers.Folder
+	packSizes []uint64
+	sizes     []uint64
+	crcs      []uint32
+}
+
+func newFolderWriter(w io.Writer, methods []uint32, wo *WriterOptions) (*folderWriter, error) {
+	fw := &folderWriter{
+		cw:      &countWriter{w: w},
+		writers: make([]io.WriteCloser, len(methods)),
+		counts:  make([]*countWriter, len(methods)),
+		folder: &headers.Folder{
+			CoderInfo:     make([]*headers.CoderInfo, len(methods)),
+			BindPairsInfo: make([]*headers.BindPairsInfo, 0, len(methods)-1),
+			PackedIndices: []int{0},
+		},
+	}
+
+	var out io.Writer = fw.cw
+	for i := len(methods) - 1; i >= 0; i-- {
+		comp := compressor(methods[i])
+		if comp == nil {
+			return nil, ErrCompressorNotFound
+		}
+
+		wc, properties, err := comp(out, wo)
+		if err != nil {
+			return nil, err
+		}
+
+		coder := len(methods) - 1 - i
+		fw.writers[i] = wc
+		fw.counts[i] = &countWriter{w: wc}
+		fw.folder.CoderInfo[coder] = &headers.CoderInfo{
+			CodecID:       methods[i],
+			Properties:    properties,
+			NumInStreams:  1,
+			NumOutStreams: 1,
+		}
+		if coder > 0 {
+			fw.folder.BindPairsInfo = append(fw.folder.BindPairsInfo, &headers.BindPairsInfo{
+				InIndex:  coder,
+				OutIndex: coder - 1,
+			})
+		}
+
+		out = fw.counts[i]
+	}
+	fw.w = out
+
+	return fw, nil
+}
+
+// Close closes each coder in turn, flushing their output, and records the
+// folder's unpack and pack sizes.
+func (fw *folderWriter) Close() error {
+	fw.folder.UnpackSizes = make([]uint64, len(fw.writers))
+	for i, wc := range fw.writers {
+		if err := wc.Close(); err != nil {
+			return err
+		}
+		fw.folder.UnpackSizes[len(fw.writers)-1-i] = uint64(fw.counts[i].n)
+	}
+	fw.packSizes = []uint64{uint64(fw.cw.n)}
+
+	return nil
+}
+
+type fileWriter struct {
+	sz     *Writer
+	fi     *headers.FileInfo
+	crc    hash.Hash32
+	size   uint64
+	closed bool
+}
+
+func (fw *fileWriter) Write(p []byte) (int, error) {
+	if fw.closed {
+		return 0, ErrWriterClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if fw.sz.folder == nil {
+		if err := fw.sz.openFolder(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := fw.sz.folder.w.Write(p)
+	fw.crc.Write(p[:n])
+	fw.size += uint64(n)
+
+	return n, err
+}
+
+type noContentsWriter struct{}
+
+func (noContentsWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return 0, ErrEntryHasNoContents
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,299 @@
+package go7z
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/saracen/go7z/filters"
+	"github.com/saracen/go7z/headers"
+)
+
+type testEntry struct {
+	Name     string
+	Contents []byte
+	Dir      bool
+	Attrib   uint32
+}
+
+var testEntries = []testEntry{
+	{Name: "dir", Dir: true},
+	{Name: "dir/hello.txt", Contents: []byte("hello world\n")},
+	{Name: "dir/empty.txt"},
+	{Name: "random.bin", Contents: bytes.Repeat([]byte("0123456789abcdef"), 64*1024)},
+	{Name: "unicode-éè.txt", Contents: []byte("café")},
+}
+
+// writeTestArchive writes entries to a temporary archive, which is closed and
+// removed when the test finishes.
+func writeTestArchive(t *testing.T, entries []testEntry, opts func(*WriterOptions)) *os.File {
+	f, err := ioutil.TempFile("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		f.Close()
+		os.Remove(f.Name())
+	})
+
+	writeTestEntries(t, f, entries, opts)
+	return f
+}
+
+// openTestArchive writes entries to a temporary archive and opens it.
+func openTestArchive(t *testing.T, entries []testEntry, opts func(*WriterOptions)) *Reader {
+	f := writeTestArchive(t, entries, opts)
+
+	sz, err := NewReader(f, testArchiveSize(t, f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sz
+}
+
+// testArchiveSize returns the size of an archive written by writeTestArchive.
+func testArchiveSize(t *testing.T, f *os.File) int64 {
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Size()
+}
+
+func writeTestEntries(t *testing.T, dst io.Writer, entries []testEntry, opts func(*WriterOptions)) {
+	w, err := NewWriter(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts != nil {
+		opts(&w.Options)
+	}
+
+	modified := time.Date(2019, 6, 23, 16, 57, 46, 0, time.UTC)
+	for _, entry := range entries {
+		fw, err := w.Create(&headers.FileInfo{
+			Name:          entry.Name,
+			IsEmptyStream: entry.Dir,
+			Attrib:        entry.Attrib,
+			ModifiedAt:    modified,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = fw.Write(entry.Contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkTestArchive(t *testing.T, f *os.File, entries []testEntry, opts ReaderOptions) {
+	sz, err := NewReaderWithOptions(f, testArchiveSize(t, f), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		hdr, err := sz.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if hdr.Name != entry.Name {
+			t.Fatalf("expected name %q, got %q", entry.Name, hdr.Name)
+		}
+		if isDir := hdr.IsEmptyStream && !hdr.IsEmptyFile; isDir != entry.Dir {
+			t.Fatalf("%v: expected directory %v, got %v", entry.Name, entry.Dir, isDir)
+		}
+		if !hdr.ModifiedAt.Equal(time.Date(2019, 6, 23, 16, 57, 46, 0, time.UTC)) {
+			t.Fatalf("%v: unexpected modified time %v", entry.Name, hdr.ModifiedAt)
+		}
+
+		contents, err := ioutil.ReadAll(sz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, entry.Contents) {
+			t.Fatalf("%v: contents mismatch", entry.Name)
+		}
+	}
+
+	if _, err := sz.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tests := map[string]func(*WriterOptions){
+		"lzma2":     nil,
+		"copy":      func(o *WriterOptions) { o.SetMethod(0x00) },
+		"non-solid": func(o *WriterOptions) { o.SetSolid(false) },
+	}
+
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := writeTestArchive(t, testEntries, opts)
+
+			checkTestArchive(t, f, testEntries, ReaderOptions{})
+		})
+	}
+}
+
+func TestWriterNonSeekable(t *testing.T) {
+	f := writeTestArchive(t, testEntries, nil)
+
+	expected, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the archive is buffered, and written as if w could seek
+	var buf bytes.Buffer
+	writeTestEntries(t, &buf, testEntries, nil)
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatal("expected archive to match the one written with seeking")
+	}
+}
+
+func TestWriterNoStreams(t *testing.T) {
+	entries := []testEntry{{Name: "dir", Dir: true}, {Name: "empty.txt"}}
+
+	f := writeTestArchive(t, entries, nil)
+
+	checkTestArchive(t, f, entries, ReaderOptions{})
+}
+
+func TestWriterDirectoryContents(t *testing.T) {
+	f, err := ioutil.TempFile("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w, err := NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fw, err := w.Create(&headers.FileInfo{Name: "dir", IsEmptyStream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fw.Write([]byte("contents")); err != ErrEntryHasNoContents {
+		t.Fatalf("expected ErrEntryHasNoContents, got %v", err)
+	}
+}
+
+func TestWriterEncryption(t *testing.T) {
+	tests := map[string]bool{
+		"data":   false,
+		"header": true,
+	}
+
+	for name, encryptHeader := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := writeTestArchive(t, testEntries, func(o *WriterOptions) {
+				o.SetPassword("password")
+				o.SetNumCyclesPower(10)
+				o.SetHeaderEncryption(encryptHeader)
+			})
+
+			var opts ReaderOptions
+			opts.SetPassword("password")
+			checkTestArchive(t, f, testEntries, opts)
+
+			data, err := ioutil.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := []byte{'r', 0, 'a', 0, 'n', 0, 'd', 0, 'o', 0, 'm', 0}
+			if bytes.Contains(data, name) == encryptHeader {
+				t.Fatalf("expected file names to be encrypted: %v", encryptHeader)
+			}
+		})
+	}
+}
+
+func TestWriterHeaderEncryptionPasswordRequired(t *testing.T) {
+	f, err := ioutil.TempFile("", "go7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w, err := NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Options.SetHeaderEncryption(true)
+
+	if _, err = w.Create(&headers.FileInfo{Name: "file"}); err != ErrPasswordRequired {
+		t.Fatalf("expected ErrPasswordRequired, got %v", err)
+	}
+}
+
+func TestWriterEncryptionSharedKey(t *testing.T) {
+	f := writeTestArchive(t, testEntries, func(o *WriterOptions) {
+		o.SetSolid(false)
+		o.SetPassword("password")
+		o.SetNumCyclesPower(10)
+	})
+
+	var opts ReaderOptions
+	opts.SetPassword("password")
+	checkTestArchive(t, f, testEntries, opts)
+
+	sz, err := NewReaderWithOptions(f, testArchiveSize(t, f), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sz.folders) < 2 {
+		t.Fatalf("expected multiple folders, got %d", len(sz.folders))
+	}
+
+	// each folder uses the key derived for the archive, but its own iv
+	ivs := make(map[string]bool)
+	salt := sz.folders[0].folder.CoderInfo[0].Properties[2:18]
+	for _, folder := range sz.folders {
+		properties := folder.folder.CoderInfo[0].Properties
+		if folder.folder.CoderInfo[0].CodecID != methodAES || len(properties) != 34 {
+			t.Fatalf("unexpected aes coder %+v", folder.folder.CoderInfo[0])
+		}
+		if !bytes.Equal(properties[2:18], salt) {
+			t.Fatal("expected folders to share the same salt")
+		}
+		ivs[string(properties[18:])] = true
+	}
+	if len(ivs) != len(sz.folders) {
+		t.Fatal("expected each folder to have its own iv")
+	}
+}
+
+func TestWriterEncryptionInvalidPower(t *testing.T) {
+	for _, power := range []int{-1, filters.AESMaxPower + 1, 0x45} {
+		w, err := NewWriter(new(bytes.Buffer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Options.SetPassword("password")
+		w.Options.SetNumCyclesPower(power)
+
+		fw, err := w.Create(&headers.FileInfo{Name: "file"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = fw.Write([]byte("contents")); !errors.Is(err, filters.ErrAESInvalidPower) {
+			t.Errorf("%d: expected filters.ErrAESInvalidPower, got %v", power, err)
+		}
+	}
+}